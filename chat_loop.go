@@ -1,204 +1,385 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/engine"
 	"github.com/ian-kent/gptchat/module"
-	"github.com/ian-kent/gptchat/parser"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/session"
 	"github.com/ian-kent/gptchat/ui"
 	"github.com/ian-kent/gptchat/util"
-	"github.com/sashabaranov/go-openai"
 )
 
-func chatLoop(cfg config.Config) {
-RESET:
-	appendMessage(openai.ChatMessageRoleSystem, systemPrompt)
-	if cfg.IsDebugMode() {
-		ui.PrintChatDebug(ui.System, systemPrompt)
+// terminal is the terminal front end for the engine
+type terminal struct{}
+
+// Read returns io.EOF once Ctrl-C has been used to quit, so the
+// engine stops in the same way it does at the end of the input
+func (terminal) Read() (string, error) {
+	input, ok := readUntilQuit(ui.PromptChatInput)
+	if !ok {
+		return "", io.EOF
 	}
+	return input, nil
+}
+
+func (terminal) Confirm(question string) bool {
+	answer, _ := readUntilQuit(func() bool {
+		return ui.PromptConfirm(question)
+	})
+	return answer
+}
 
-	var skipUserInput = true
-	appendMessage(openai.ChatMessageRoleUser, openingPrompt)
-	if cfg.IsDebugMode() {
-		ui.PrintChatDebug(ui.User, openingPrompt)
+func (terminal) Choose(question string, n int) int {
+	for {
+		input, ok := readUntilQuit(func() string {
+			return ui.PromptInput(fmt.Sprintf("%s [1-%d]:", question, n))
+		})
+		if !ok {
+			return 0
+		}
+		choice, err := strconv.Atoi(input)
+		ui.Println()
+		if err == nil && choice >= 1 && choice <= n {
+			return choice - 1
+		}
 	}
+}
+
+func (terminal) Chat(name, message string) {
+	ui.PrintChat(name, message)
+}
+
+func (terminal) Debug(name, message string) {
+	ui.PrintChatDebug(name, message)
+}
+
+func (terminal) Info(message string) {
+	ui.Info(message)
+	ui.Println()
+}
 
-	if !cfg.IsDebugMode() {
-		ui.PrintChat(ui.App, "Setting up the chat environment, please wait for GPT to respond - this may take a few moments.")
+func (terminal) Error(message string, err error) {
+	ui.Error(message, err)
+}
+
+func (terminal) Stream(name string, hideCommands bool) session.Stream {
+	return ui.NewChatStream(name, hideCommands)
+}
+
+// newTerminalEngine returns an engine which runs a conversation in the terminal
+func newTerminalEngine() *engine.Engine {
+	e := engine.New(cfg, client, module.Default(), terminal{}, terminal{})
+	e.Hooks.Input = handleSlashCommand
+	// Ctrl-C cancels the current turn
+	e.Context = interrupts.start
+	return e
+}
+
+// handleSlashCommand handles the slash commands which are meant for
+// GPTChat rather than GPT, and returns true if input was one of them
+func handleSlashCommand(e *engine.Engine, input string) bool {
+	ok, result := parseSlashCommand(input)
+	if !ok {
+		return false
+	}
+	// the command was handled but returned nothing
+	// to send to the AI, let's prompt the user again
+	if result == nil {
+		return true
 	}
 
-	var i int
-	for {
-		i++
-
-		if !skipUserInput {
-			input := ui.PromptChatInput()
-			var echo bool
-
-			ok, result := parseSlashCommand(input)
-			if ok {
-				// the command was handled but returned nothing
-				// to send to the AI, let's prompt the user again
-				if result == nil {
-					continue
-				}
-
-				if result.resetConversation {
-					resetConversation()
-					goto RESET
-				}
-
-				// if the result is a retry, we can just send the
-				// same request to GPT again
-				if result.retry {
-					skipUserInput = true
-					goto RETRY
-				}
-
-				if result.toggleDebugMode {
-					cfg = cfg.WithDebugMode(!cfg.IsDebugMode())
-					module.UpdateConfig(cfg)
-					if cfg.IsDebugMode() {
-						ui.PrintChat(ui.App, "Debug mode is now enabled")
-					} else {
-						ui.PrintChat(ui.App, "Debug mode is now disabled")
-					}
-					continue
-				}
-
-				if result.toggleSupervisedMode {
-					cfg = cfg.WithSupervisedMode(!cfg.IsSupervisedMode())
-					module.UpdateConfig(cfg)
-					if cfg.IsSupervisedMode() {
-						ui.PrintChat(ui.App, "Supervised mode is now enabled")
-					} else {
-						ui.PrintChat(ui.App, "Supervised mode is now disabled")
-					}
-					continue
-				}
-
-				// we have a prompt to give to the AI, let's do that
-				if result.prompt != "" {
-					input = result.prompt
-					echo = true
-				}
-			}
-
-			if echo {
-				ui.PrintChat(ui.User, input)
-				echo = false
-			}
-
-			appendMessage(openai.ChatMessageRoleUser, input)
-		}
-
-		skipUserInput = false
-
-	RETRY:
-
-		// Occasionally include the interval prompt
-		if i%5 == 0 {
-			interval := intervalPrompt()
-			appendMessage(openai.ChatMessageRoleSystem, interval)
-			if cfg.IsDebugMode() {
-				ui.PrintChatDebug(ui.System, interval)
-			}
-		}
-
-		attempts := 1
-	RATELIMIT_RETRY:
-		resp, err := client.CreateChatCompletion(
-			context.Background(),
-			openai.ChatCompletionRequest{
-				Model:    cfg.OpenAIAPIModel(),
-				Messages: conversation,
-			},
-		)
+	chat := e.Session()
+
+	switch {
+	case result.resetConversation:
+		e.Reset()
+
+	// if the result is a retry, we can just send the
+	// same request to GPT again
+	case result.retry:
+		e.Retry()
+
+	case result.regenerate:
+		e.Regenerate(result.candidates)
+
+	case result.undo:
+		if !e.Undo() {
+			ui.PrintChat(ui.App, "There's nothing to undo")
+			break
+		}
+		ui.PrintChat(ui.App, "Your last message has been removed, use /branches to see the earlier version of the conversation")
+
+	case result.editMessage == -1:
+		printUserMessages(chat)
+
+	case result.editMessage > 0:
+		ui.PrintChat(ui.User, result.editText)
+		if err := e.Edit(result.editMessage, result.editText); err != nil {
+			ui.Error("Error editing the message", err)
+			ui.Println()
+			return true
+		}
+
+	case result.listBranches:
+		printBranches(chat)
+
+	case result.switchBranch != 0:
+		if err := chat.SwitchBranch(result.switchBranch); err != nil {
+			ui.Error("Error switching branch", err)
+			ui.Println()
+			return true
+		}
+		printLastResponse(chat)
+		ui.PrintChat(ui.App, fmt.Sprintf("Switched to branch %d (%d messages)", result.switchBranch, len(chat.Messages())))
+
+	case result.saveConversation:
+		name, err := chat.Save(result.saveName)
 		if err != nil {
-			if strings.HasPrefix(err.Error(), "error, status code: 429") && attempts < 5 {
-				attempts++
-				ui.Error("rate limited, trying again in 1 second", err)
-				time.Sleep(time.Second)
-				goto RATELIMIT_RETRY
-			}
-
-			ui.Error("ChatCompletion failed", err)
-			if ui.PromptConfirm("Would you like to try again?") {
-				goto RATELIMIT_RETRY
-			}
+			ui.Error("Error saving the conversation", err)
+			ui.Println()
+			return true
+		}
+		ui.PrintChat(ui.App, fmt.Sprintf("The conversation has been saved, you can load it using /load %s", name))
 
-			continue
+	case result.loadConversation != "":
+		if err := chat.Load(result.loadConversation); err != nil {
+			ui.Error("Error loading the conversation", err)
+			ui.Println()
+			return true
 		}
+		printResumed(chat)
 
-		response := resp.Choices[0].Message.Content
-		appendMessage(openai.ChatMessageRoleAssistant, response)
-		if cfg.IsDebugMode() {
-			ui.PrintChat(ui.AI, response)
+	case result.listConversations:
+		printConversations()
+
+	case result.showUsage:
+		ui.PrintChat(ui.App, fmt.Sprintf("This session:\n\n%s\n\nAll sessions:\n\n%s", chat.Usage().Summary(), lifetimeUsage.Summary()))
+
+	case result.exportConversation:
+		if err := exportConversation(chat, result.exportFormat, result.exportPath); err != nil {
+			ui.Error("Error exporting the conversation", err)
+			ui.Println()
+			return true
+		}
+		ui.PrintChat(ui.App, fmt.Sprintf("The conversation has been exported to %s", result.exportPath))
+
+	case result.model && result.modelName == "":
+		printModels(chat.Config())
+
+	case result.model:
+		cfg := chat.Config()
+		if result.modelModule != "" {
+			cfg = cfg.WithModuleModel(result.modelModule, result.modelName)
+			ui.PrintChat(ui.App, fmt.Sprintf("The %s module is now using %s", result.modelModule, result.modelName))
+		} else {
+			cfg = cfg.WithOpenAIAPIModel(result.modelName)
+			ui.PrintChat(ui.App, fmt.Sprintf("The conversation is now using %s", result.modelName))
+		}
+		chat.SetConfig(cfg)
+
+	case result.setParameter && result.parameterName == "":
+		printSampling(chat.Config())
+
+	case result.setParameter:
+		cfg, err := chat.Config().WithSamplingParameter(result.parameterName, result.parameterValue)
+		if err != nil {
+			ui.Error("Error setting the parameter", err)
+			ui.Println()
+			return true
 		}
+		chat.SetConfig(cfg)
+		ui.PrintChat(ui.App, fmt.Sprintf("%s is now %s", result.parameterName, cfg.SamplingParameter(result.parameterName)))
 
-		parseResult := parser.Parse(response)
+	case result.showConfig:
+		printConfig(chat.Config())
 
-		if !cfg.IsDebugMode() && parseResult.Chat != "" {
-			ui.PrintChat(ui.AI, parseResult.Chat)
+	case result.toggleDebugMode:
+		cfg := chat.Config()
+		cfg = cfg.WithDebugMode(!cfg.IsDebugMode())
+		chat.SetConfig(cfg)
+		if cfg.IsDebugMode() {
+			ui.PrintChat(ui.App, "Debug mode is now enabled")
+		} else {
+			ui.PrintChat(ui.App, "Debug mode is now disabled")
 		}
 
-		for _, command := range parseResult.Commands {
-			ok, result := module.ExecuteCommand(command.Command, command.Args, command.Body)
-			if ok {
-				// we had at least one AI command so we're going to respond automatically,
-				// no need to ask for user input
-				skipUserInput = true
+	case result.toggleStreamingMode:
+		cfg := chat.Config()
+		cfg = cfg.WithStreamingMode(!cfg.IsStreamingMode())
+		chat.SetConfig(cfg)
+		if cfg.IsStreamingMode() {
+			ui.PrintChat(ui.App, "Streaming mode is now enabled")
+		} else {
+			ui.PrintChat(ui.App, "Streaming mode is now disabled")
+		}
 
-				if result.Error != nil {
-					msg := fmt.Sprintf(`An error occurred executing your command.
+	case result.toggleSupervisedMode:
+		cfg := chat.Config()
+		cfg = cfg.WithSupervisedMode(!cfg.IsSupervisedMode())
+		chat.SetConfig(cfg)
+		if cfg.IsSupervisedMode() {
+			ui.PrintChat(ui.App, "Supervised mode is now enabled")
+		} else {
+			ui.PrintChat(ui.App, "Supervised mode is now disabled")
+		}
 
-The command was:
-`+util.TripleQuote+`
-%s
-`+util.TripleQuote+`
+	// we have a prompt to give to the AI, let's do that
+	case result.prompt != "":
+		ui.PrintChat(ui.User, result.prompt)
+		e.Send(result.prompt)
+	}
 
-The error was:
-`+util.TripleQuote+`
-%s
-`+util.TripleQuote, command.String(), result.Error.Error())
+	return true
+}
 
-					if result.Prompt != "" {
-						msg += fmt.Sprintf(`
+// printResumed tells the user which conversation has been loaded, and
+// reminds them where it got up to
+func printResumed(chat *session.Session) {
+	cfg := chat.Config()
+	if !cfg.IsSupervisedMode() {
+		ui.Warn("Supervisor mode is disabled")
+		ui.Println()
+	}
+
+	printLastResponse(chat)
+	ui.PrintChat(ui.App, fmt.Sprintf("Loaded %s (%d messages, using %s)", chat.Name(), len(chat.Messages()), cfg.OpenAIAPIModel()))
+}
 
-The command provided this additional output:
-`+util.TripleQuote+`
-%s
-`+util.TripleQuote, result.Prompt)
-					}
+// printLastResponse reminds the user what GPT last said
+func printLastResponse(chat *session.Session) {
+	messages := chat.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != provider.RoleAssistant {
+			continue
+		}
+		if text := chat.ResponseChat(messages[i]); text != "" {
+			ui.PrintChat(ui.AI, text)
+		}
+		break
+	}
+}
 
-					appendMessage(openai.ChatMessageRoleSystem, msg)
-					if cfg.IsDebugMode() {
-						ui.PrintChatDebug(ui.Module, msg)
-					}
-					continue
-				}
+func printConversations() {
+	conversations, err := session.List()
+	if err != nil {
+		ui.Error("Error listing saved conversations", err)
+		ui.Println()
+		return
+	}
+	if len(conversations) == 0 {
+		ui.PrintChat(ui.App, "There aren't any saved conversations, you can save this one using /save [name]")
+		return
+	}
 
-				commandResult := fmt.Sprintf(`Your command returned some output.
+	result := "The following conversations have been saved:\n"
+	for _, conversation := range conversations {
+		result += fmt.Sprintf("\n    %s (%d messages, using %s, saved %s)", conversation.Name, conversation.Messages, conversation.Model, conversation.Saved.Format(util.DateFormat))
+	}
+	result += "\n\nUse /load <name> to load one"
+	ui.PrintChat(ui.App, result)
+}
 
-The command was:
-`+util.TripleQuote+`
-%s
-`+util.TripleQuote+`
+// printUserMessages lists the user's messages on the current branch, so they can choose one to edit
+func printUserMessages(chat *session.Session) {
+	messages := chat.UserMessages()
+	if len(messages) == 0 {
+		ui.PrintChat(ui.App, "You haven't sent any messages yet")
+		return
+	}
 
-The output was:
+	result := "You've sent the following messages:\n"
+	for i, message := range messages {
+		result += fmt.Sprintf("\n    %d: %s", i+1, message)
+	}
+	result += "\n\nUse /edit <n> <message> to replace one, which starts a new branch of the conversation"
+	ui.PrintChat(ui.App, result)
+}
 
-%s`, command.String(), result.Prompt)
-				appendMessage(openai.ChatMessageRoleSystem, commandResult)
+func printBranches(chat *session.Session) {
+	branches := chat.Branches()
+	if len(branches) == 1 {
+		ui.PrintChat(ui.App, "The conversation only has one branch, use /undo or /edit to start another")
+		return
+	}
 
-				if cfg.IsDebugMode() {
-					ui.PrintChatDebug(ui.Module, commandResult)
-				}
-				continue
-			}
+	result := "The conversation has the following branches:\n"
+	for _, branch := range branches {
+		current := ""
+		if branch.Current {
+			current = " (current)"
 		}
+		from := ""
+		if branch.Parent != 0 {
+			from = fmt.Sprintf(", started from %d", branch.Parent)
+		}
+		last := branch.Last
+		if last == "" {
+			last = "no messages from you"
+		}
+		result += fmt.Sprintf("\n    %d%s: %s (%d messages%s)", branch.ID, current, last, branch.Messages, from)
+	}
+	result += "\n\nUse /branch <n> to switch to one"
+	ui.PrintChat(ui.App, result)
+}
+
+func printModels(cfg config.Config) {
+	result := fmt.Sprintf("The conversation is using %s\n", cfg.OpenAIAPIModel())
+
+	models := cfg.ModuleModels()
+	var modules []string
+	for module := range models {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		result += fmt.Sprintf("\n    The %s module is using %s", module, models[module])
+	}
+
+	result += "\n\nUse /model <name> to switch models, or /model <module> <name> to switch the model a module uses"
+	ui.PrintChat(ui.App, result)
+}
+
+func printConfig(cfg config.Config) {
+	settings, err := cfg.YAML()
+	if err != nil {
+		ui.Error("Error showing the config", err)
+		ui.Println()
+		return
+	}
+
+	source := "There isn't a config file, so the config comes from the defaults and environment variables"
+	if configSource != "" {
+		source = fmt.Sprintf("The config was loaded from %s, along with any environment variables and flags", configSource)
+	}
+	ui.PrintChat(ui.App, fmt.Sprintf("%s. The conversation is using these settings:\n\n%s", source, strings.TrimSpace(settings)))
+}
+
+func printSampling(cfg config.Config) {
+	result := "The sampling parameters are:\n"
+	for _, name := range config.SamplingParameters {
+		result += fmt.Sprintf("\n    %s: %s", name, cfg.SamplingParameter(name))
+	}
+	result += "\n\nUse /set <name> <value> to change one, or /set <name> default to unset it"
+	ui.PrintChat(ui.App, result)
+}
+
+func exportConversation(chat *session.Session, format, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := chat.Export(f, format); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
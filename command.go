@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"github.com/ian-kent/gptchat/session"
 	"github.com/ian-kent/gptchat/ui"
 	"os"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +16,40 @@ type slashCommandResult struct {
 	// retry tells the client to resend the most recent conversation
 	retry bool
 
+	// regenerate removes GPT's last response and asks it to respond again,
+	// letting the user choose between candidates if there's more than one
+	regenerate bool
+	candidates int
+
+	// undo removes the user's last message, and everything after it
+	undo bool
+
+	// editMessage replaces the user's nth message with editText, starting a
+	// new branch of the conversation
+	editMessage int
+	editText    string
+
+	// listBranches lists the branches of the conversation
+	listBranches bool
+
+	// switchBranch moves the conversation to another branch
+	switchBranch int
+
+	// model switches the model used by the conversation to modelName, or the
+	// model used by modelModule if it's set. If modelName is empty, the
+	// models being used are shown instead.
+	model       bool
+	modelModule string
+	modelName   string
+
+	// setParameter sets a sampling parameter, or shows them all if parameterName is empty
+	setParameter   bool
+	parameterName  string
+	parameterValue string
+
+	// showConfig shows the config the conversation is using
+	showConfig bool
+
 	// resetConversation will reset the conversation to its original state,
 	// forgetting the conversation history
 	resetConversation bool
@@ -23,6 +59,28 @@ type slashCommandResult struct {
 
 	// toggleSupervisedMode will switch between supervised mode on and off
 	toggleSupervisedMode bool
+
+	// toggleStreamingMode will switch between streaming mode on and off
+	toggleStreamingMode bool
+
+	// saveConversation saves the conversation as saveName, or using
+	// its current name if saveName is empty
+	saveConversation bool
+	saveName         string
+
+	// loadConversation replaces the conversation with a saved conversation
+	loadConversation string
+
+	// listConversations lists the saved conversations
+	listConversations bool
+
+	// exportConversation writes the transcript to exportPath using exportFormat
+	exportConversation bool
+	exportFormat       string
+	exportPath         string
+
+	// showUsage shows the tokens used and what they cost
+	showUsage bool
 }
 
 type slashCommand struct {
@@ -46,6 +104,44 @@ var slashCommands = []slashCommand{
 			}
 		},
 	},
+	{
+		command: "regenerate",
+		fn:      regenerateCommand,
+	},
+	{
+		command: "undo",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				undo: true,
+			}
+		},
+	},
+	{
+		command: "edit",
+		fn:      editCommand,
+	},
+	{
+		command: "branches",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				listBranches: true,
+			}
+		},
+	},
+	{
+		command: "branch",
+		fn: func(s string) (bool, *slashCommandResult) {
+			id, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil {
+				ui.Warn("You need to say which branch to switch to, e.g. /branch 2, or use /branches to list them")
+				ui.Println()
+				return true, nil
+			}
+			return true, &slashCommandResult{
+				switchBranch: id,
+			}
+		},
+	},
 	{
 		command: "reset",
 		fn: func(s string) (bool, *slashCommandResult) {
@@ -54,6 +150,53 @@ var slashCommands = []slashCommand{
 			}
 		},
 	},
+	{
+		command: "model",
+		fn: func(s string) (bool, *slashCommandResult) {
+			result := &slashCommandResult{model: true}
+			parts := strings.Fields(s)
+			switch len(parts) {
+			case 0:
+			case 1:
+				result.modelName = parts[0]
+			case 2:
+				result.modelModule = strings.TrimPrefix(parts[0], "/")
+				result.modelName = parts[1]
+			default:
+				ui.Warn("You need to say which model to use, e.g. /model gpt-4, or /model memory gpt-3.5-turbo for a module")
+				ui.Println()
+				return true, nil
+			}
+			return true, result
+		},
+	},
+	{
+		command: "set",
+		fn: func(s string) (bool, *slashCommandResult) {
+			parts := strings.SplitN(strings.TrimSpace(s), " ", 2)
+			result := &slashCommandResult{
+				setParameter:  true,
+				parameterName: parts[0],
+			}
+			if len(parts) > 1 {
+				result.parameterValue = parts[1]
+			}
+			if result.parameterName != "" && result.parameterValue == "" {
+				ui.Warn("You need to give the parameter a value, e.g. /set temperature 0.2, or /set temperature default to unset it")
+				ui.Println()
+				return true, nil
+			}
+			return true, result
+		},
+	},
+	{
+		command: "config",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				showConfig: true,
+			}
+		},
+	},
 	{
 		command: "debug",
 		fn: func(s string) (bool, *slashCommandResult) {
@@ -70,12 +213,120 @@ var slashCommands = []slashCommand{
 			}
 		},
 	},
+	{
+		command: "stream",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				toggleStreamingMode: true,
+			}
+		},
+	},
+	{
+		command: "save",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				saveConversation: true,
+				saveName:         strings.TrimSpace(s),
+			}
+		},
+	},
+	{
+		command: "load",
+		fn: func(s string) (bool, *slashCommandResult) {
+			name := strings.TrimSpace(s)
+			if name == "" {
+				ui.Warn("You need to say which conversation to load, e.g. /load my-conversation")
+				ui.Println()
+				return true, nil
+			}
+			return true, &slashCommandResult{
+				loadConversation: name,
+			}
+		},
+	},
+	{
+		command: "sessions",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				listConversations: true,
+			}
+		},
+	},
+	{
+		command: "export",
+		fn:      exportCommand,
+	},
+	{
+		command: "usage",
+		fn: func(s string) (bool, *slashCommandResult) {
+			return true, &slashCommandResult{
+				showUsage: true,
+			}
+		},
+	},
 	{
 		command: "example",
 		fn:      exampleCommand,
 	},
 }
 
+func regenerateCommand(args string) (bool, *slashCommandResult) {
+	candidates := 1
+	if args = strings.TrimSpace(args); args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 {
+			ui.Warn("You need to say how many responses GPT should generate, e.g. /regenerate 3")
+			ui.Println()
+			return true, nil
+		}
+		candidates = n
+	}
+
+	return true, &slashCommandResult{
+		regenerate: true,
+		candidates: candidates,
+	}
+}
+
+// editCommand parses /edit <n> <message>. Without any arguments, the user's
+// messages are listed so they can see which one to edit.
+func editCommand(args string) (bool, *slashCommandResult) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		return true, &slashCommandResult{
+			editMessage: -1,
+		}
+	}
+
+	parts := strings.SplitN(args, " ", 2)
+	n, err := strconv.Atoi(parts[0])
+	if err != nil || n < 1 || len(parts) < 2 || strings.TrimSpace(parts[1]) == "" {
+		ui.Warn("You need to say which message to edit and what to replace it with, e.g. /edit 2 What's the weather like?")
+		ui.Println()
+		return true, nil
+	}
+
+	return true, &slashCommandResult{
+		editMessage: n,
+		editText:    strings.TrimSpace(parts[1]),
+	}
+}
+
+func exportCommand(args string) (bool, *slashCommandResult) {
+	parts := strings.SplitN(strings.TrimSpace(args), " ", 2)
+	if len(parts) < 2 || (parts[0] != session.FormatMarkdown && parts[0] != session.FormatJSON) {
+		ui.Warn("You need to say which format to use and where to write the transcript, e.g. /export md conversation.md")
+		ui.Println()
+		return true, nil
+	}
+
+	return true, &slashCommandResult{
+		exportConversation: true,
+		exportFormat:       parts[0],
+		exportPath:         strings.TrimSpace(parts[1]),
+	}
+}
+
 func helpCommand(string) (bool, *slashCommandResult) {
 	result := "The following commands are available:\n"
 	for _, e := range slashCommands {
@@ -1,28 +1,160 @@
 package config
 
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/ian-kent/gptchat/provider"
+)
+
+const (
+	// ContextStrategyDrop drops the oldest messages when the context window is full
+	ContextStrategyDrop = "drop"
+	// ContextStrategySummarise replaces the oldest messages with a summary when the context window is full
+	ContextStrategySummarise = "summarise"
+)
+
+// Providers are the names of the providers GPTChat can use
+var Providers = []string{"openai", "azure", "openai-compatible"}
+
+// Themes are the names of the themes the UI can use
+var Themes = []string{"light", "dark"}
+
 type Config struct {
-	openaiAPIKey   string
+	provider       string
 	openaiAPIModel string
+	moduleModels   map[string]string
+	fallbackModels []string
+
+	// the API key isn't part of the config, since the config is given to
+	// every module, only how to find it is
+	keyCommand string
+	keyring    bool
+
+	sampling provider.Sampling
 
 	supervisedMode bool
 	debugMode      bool
+	streamingMode  bool
+	toolsMode      bool
+
+	contextBudget   int
+	contextStrategy string
+
+	retryMaxAttempts int
+	retryBaseDelay   time.Duration
+	retryMaxDelay    time.Duration
+
+	usageWarnLimit float64
+	usageLimit     float64
+
+	maxAutonomousTurns  int
+	maxRepeatedCommands int
+
+	intervalPromptTurns int
+	intervalPromptTime  time.Duration
+
+	concurrentCommands int
+
+	outputLimit        int
+	moduleOutputLimits map[string]int
+	outputPaging       bool
+
+	candidates int
+
+	// dataDir is where GPTChat stores its data, and the paths
+	// below are in it unless they've been set
+	dataDir            string
+	memoryPath         string
+	pluginSourcePath   string
+	pluginCompiledPath string
+
+	theme string
 }
 
 func New() Config {
 	return Config{
-		openaiAPIKey:   "",
+		provider:       "openai",
 		openaiAPIModel: "",
+		keyring:        true,
 		supervisedMode: true,
 		debugMode:      false,
+		streamingMode:  false,
+		toolsMode:      false,
+
+		contextBudget:   0,
+		contextStrategy: ContextStrategyDrop,
+
+		retryMaxAttempts: 5,
+		retryBaseDelay:   time.Second,
+		retryMaxDelay:    30 * time.Second,
+
+		maxAutonomousTurns:  10,
+		maxRepeatedCommands: 3,
+
+		intervalPromptTurns: 5,
+		intervalPromptTime:  0,
+
+		concurrentCommands: 1,
+
+		outputLimit:  10000,
+		outputPaging: false,
+
+		candidates: 1,
+
+		theme: "light",
 	}
 }
 
+// Provider is the name of the provider used to talk to GPT, one of Providers
+func (c Config) Provider() string {
+	return c.provider
+}
+
 func (c Config) OpenAIAPIModel() string {
 	return c.openaiAPIModel
 }
 
-func (c Config) OpenAIAPIKey() string {
-	return c.openaiAPIKey
+// ModuleModel is the model used by requests a module makes, which is the
+// same model as the conversation unless the module has its own
+func (c Config) ModuleModel(module string) string {
+	if model, ok := c.moduleModels[module]; ok {
+		return model
+	}
+	return c.openaiAPIModel
+}
+
+// ModuleModels returns the modules which use their own model
+func (c Config) ModuleModels() map[string]string {
+	models := make(map[string]string, len(c.moduleModels))
+	for k, v := range c.moduleModels {
+		models[k] = v
+	}
+	return models
+}
+
+// FallbackModels are the models requests fall back to, in order, when the model
+// they're using is unavailable. Each one can use a different provider by
+// starting with the provider's name, for example openai-compatible:llama3.
+func (c Config) FallbackModels() []string {
+	return append([]string{}, c.fallbackModels...)
+}
+
+// Sampling controls how GPT generates responses, for the conversation and for modules
+func (c Config) Sampling() provider.Sampling {
+	return c.sampling
+}
+
+// KeyCommand is a command which prints the API key, for example
+// `pass show openai`, it's empty if the API key isn't read using a command
+func (c Config) KeyCommand() string {
+	return c.keyCommand
+}
+
+// IsKeyringEnabled returns true if the API key can be read from, and saved
+// to, the system keyring
+func (c Config) IsKeyringEnabled() bool {
+	return c.keyring
 }
 
 func (c Config) IsSupervisedMode() bool {
@@ -33,8 +165,154 @@ func (c Config) IsDebugMode() bool {
 	return c.debugMode
 }
 
-func (c Config) WithOpenAIAPIKey(apiKey string) Config {
-	c.openaiAPIKey = apiKey
+func (c Config) IsStreamingMode() bool {
+	return c.streamingMode
+}
+
+// IsToolsMode returns true if modules are given to GPT as tools using
+// function calling, instead of using the slash command syntax
+func (c Config) IsToolsMode() bool {
+	return c.toolsMode
+}
+
+// ContextBudget is the number of tokens available for the conversation,
+// or 0 to use the context window of the model
+func (c Config) ContextBudget() int {
+	return c.contextBudget
+}
+
+func (c Config) ContextStrategy() string {
+	return c.contextStrategy
+}
+
+func (c Config) RetryMaxAttempts() int {
+	return c.retryMaxAttempts
+}
+
+func (c Config) RetryBaseDelay() time.Duration {
+	return c.retryBaseDelay
+}
+
+func (c Config) RetryMaxDelay() time.Duration {
+	return c.retryMaxDelay
+}
+
+// UsageWarnLimit is the cost in USD after which a warning is shown, or 0 for no warning
+func (c Config) UsageWarnLimit() float64 {
+	return c.usageWarnLimit
+}
+
+// UsageLimit is the cost in USD after which requests are blocked, or 0 for no limit
+func (c Config) UsageLimit() float64 {
+	return c.usageLimit
+}
+
+// MaxAutonomousTurns is the number of turns GPT can take using commands
+// before the user is asked whether it should continue, or 0 for no limit
+func (c Config) MaxAutonomousTurns() int {
+	return c.maxAutonomousTurns
+}
+
+// MaxRepeatedCommands is the number of times GPT can use exactly the same
+// command before the user is asked whether it should continue, or 0 for no limit
+func (c Config) MaxRepeatedCommands() int {
+	return c.maxRepeatedCommands
+}
+
+// IntervalPromptTurns is the number of turns between interval prompts, or 0 to
+// only add the interval prompt based on time
+func (c Config) IntervalPromptTurns() int {
+	return c.intervalPromptTurns
+}
+
+// IntervalPromptTime is the time between interval prompts, or 0 to only add
+// the interval prompt based on the number of turns
+func (c Config) IntervalPromptTime() time.Duration {
+	return c.intervalPromptTime
+}
+
+// ConcurrentCommands is the number of commands from the same response which
+// can be executed at the same time, 1 executes them one after another
+func (c Config) ConcurrentCommands() int {
+	return c.concurrentCommands
+}
+
+// OutputLimit is the number of characters of output from a module which is
+// given to GPT, or 0 for no limit
+func (c Config) OutputLimit(module string) int {
+	if limit, ok := c.moduleOutputLimits[module]; ok {
+		return limit
+	}
+	return c.outputLimit
+}
+
+// IsOutputPaging is true if output over the limit is kept so GPT can read the rest of it
+func (c Config) IsOutputPaging() bool {
+	return c.outputPaging
+}
+
+// Candidates is the number of responses GPT generates for each message from
+// the user, for the user to choose from
+func (c Config) Candidates() int {
+	return c.candidates
+}
+
+// MemoryPath is the file the memory module stores memories in
+func (c Config) MemoryPath() string {
+	return c.dataPath(c.memoryPath, "memories.json")
+}
+
+// PluginSourcePath is the directory plugins are written to before they're compiled
+func (c Config) PluginSourcePath() string {
+	return c.dataPath(c.pluginSourcePath, filepath.Join("plugins", "source"))
+}
+
+// PluginCompiledPath is the directory compiled plugins are loaded from
+func (c Config) PluginCompiledPath() string {
+	return c.dataPath(c.pluginCompiledPath, filepath.Join("plugins", "compiled"))
+}
+
+// SessionsPath is the directory saved conversations are stored in
+func (c Config) SessionsPath() string {
+	return c.dataPath("", "sessions")
+}
+
+// UsagePath is the file usage from every session is stored in
+func (c Config) UsagePath() string {
+	return c.dataPath("", "usage.json")
+}
+
+// DataDir is the directory GPTChat stores its data in, or empty
+// to use the working directory
+func (c Config) DataDir() string {
+	return c.dataDir
+}
+
+// dataPath returns path if it's been set, otherwise name in the data directory
+func (c Config) dataPath(path, name string) string {
+	if path != "" {
+		return path
+	}
+	return filepath.Join(c.dataDir, name)
+}
+
+// Theme is the name of the theme the UI uses, one of Themes
+func (c Config) Theme() string {
+	return c.theme
+}
+
+func (c Config) WithProvider(provider string) Config {
+	c.provider = provider
+	return c
+}
+
+func (c Config) WithKeyCommand(keyCommand string) Config {
+	c.keyCommand = keyCommand
+	return c
+}
+
+func (c Config) WithKeyring(keyring bool) Config {
+	c.keyring = keyring
 	return c
 }
 
@@ -48,7 +326,156 @@ func (c Config) WithDebugMode(debugMode bool) Config {
 	return c
 }
 
+func (c Config) WithStreamingMode(streamingMode bool) Config {
+	c.streamingMode = streamingMode
+	return c
+}
+
+func (c Config) WithToolsMode(toolsMode bool) Config {
+	c.toolsMode = toolsMode
+	return c
+}
+
+func (c Config) WithContextBudget(contextBudget int) Config {
+	c.contextBudget = contextBudget
+	return c
+}
+
+func (c Config) WithContextStrategy(contextStrategy string) Config {
+	c.contextStrategy = contextStrategy
+	return c
+}
+
+func (c Config) WithRetryMaxAttempts(retryMaxAttempts int) Config {
+	c.retryMaxAttempts = retryMaxAttempts
+	return c
+}
+
+func (c Config) WithRetryBaseDelay(retryBaseDelay time.Duration) Config {
+	c.retryBaseDelay = retryBaseDelay
+	return c
+}
+
+func (c Config) WithRetryMaxDelay(retryMaxDelay time.Duration) Config {
+	c.retryMaxDelay = retryMaxDelay
+	return c
+}
+
+func (c Config) WithUsageWarnLimit(usageWarnLimit float64) Config {
+	c.usageWarnLimit = usageWarnLimit
+	return c
+}
+
+func (c Config) WithUsageLimit(usageLimit float64) Config {
+	c.usageLimit = usageLimit
+	return c
+}
+
+func (c Config) WithMaxAutonomousTurns(maxAutonomousTurns int) Config {
+	c.maxAutonomousTurns = maxAutonomousTurns
+	return c
+}
+
+func (c Config) WithMaxRepeatedCommands(maxRepeatedCommands int) Config {
+	c.maxRepeatedCommands = maxRepeatedCommands
+	return c
+}
+
+func (c Config) WithIntervalPromptTurns(intervalPromptTurns int) Config {
+	c.intervalPromptTurns = intervalPromptTurns
+	return c
+}
+
+func (c Config) WithIntervalPromptTime(intervalPromptTime time.Duration) Config {
+	c.intervalPromptTime = intervalPromptTime
+	return c
+}
+
+func (c Config) WithConcurrentCommands(concurrentCommands int) Config {
+	c.concurrentCommands = concurrentCommands
+	return c
+}
+
+func (c Config) WithOutputLimit(outputLimit int) Config {
+	c.outputLimit = outputLimit
+	return c
+}
+
+// WithModuleOutputLimit sets the output limit for a single module, which overrides the output limit
+func (c Config) WithModuleOutputLimit(module string, outputLimit int) Config {
+	// the map is copied, since it's shared with any other copies of the config
+	limits := make(map[string]int, len(c.moduleOutputLimits)+1)
+	for k, v := range c.moduleOutputLimits {
+		limits[k] = v
+	}
+	limits[module] = outputLimit
+	c.moduleOutputLimits = limits
+	return c
+}
+
+func (c Config) WithOutputPaging(outputPaging bool) Config {
+	c.outputPaging = outputPaging
+	return c
+}
+
+func (c Config) WithCandidates(candidates int) Config {
+	c.candidates = candidates
+	return c
+}
+
 func (c Config) WithOpenAIAPIModel(apiModel string) Config {
 	c.openaiAPIModel = apiModel
 	return c
 }
+
+// WithModuleModel sets the model used by a single module, or if model is
+// empty the module goes back to using the same model as the conversation
+func (c Config) WithModuleModel(module, model string) Config {
+	// the map is copied, since it's shared with any other copies of the config
+	models := make(map[string]string, len(c.moduleModels)+1)
+	for k, v := range c.moduleModels {
+		models[k] = v
+	}
+	if model == "" {
+		delete(models, module)
+	} else {
+		models[module] = model
+	}
+	c.moduleModels = models
+	return c
+}
+
+func (c Config) WithFallbackModels(fallbackModels ...string) Config {
+	c.fallbackModels = append([]string{}, fallbackModels...)
+	return c
+}
+
+func (c Config) WithSampling(sampling provider.Sampling) Config {
+	c.sampling = sampling
+	return c
+}
+
+func (c Config) WithDataDir(dataDir string) Config {
+	c.dataDir = dataDir
+	return c
+}
+
+func (c Config) WithMemoryPath(memoryPath string) Config {
+	c.memoryPath = memoryPath
+	return c
+}
+
+func (c Config) WithPluginSourcePath(pluginSourcePath string) Config {
+	c.pluginSourcePath = pluginSourcePath
+	return c
+}
+
+func (c Config) WithPluginCompiledPath(pluginCompiledPath string) Config {
+	c.pluginCompiledPath = pluginCompiledPath
+	return c
+}
+
+func (c Config) WithTheme(theme string) Config {
+	c.theme = theme
+	return c
+}
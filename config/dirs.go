@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDataDir returns the directory GPTChat stores its data in by default,
+// which is $XDG_DATA_HOME/gptchat, or ~/.local/share/gptchat if XDG_DATA_HOME
+// isn't set
+func DefaultDataDir() (string, error) {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+// DefaultConfigDir returns the directory the config file is in by default,
+// which is $XDG_CONFIG_HOME/gptchat, or ~/.config/gptchat if XDG_CONFIG_HOME
+// isn't set
+func DefaultConfigDir() (string, error) {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// xdgDir returns the gptchat directory in the base directory set by env,
+// or in home if it isn't set
+func xdgDir(env, home string) (string, error) {
+	// the spec says relative paths should be ignored
+	if dir := os.Getenv(env); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "gptchat"), nil
+	}
+
+	userHome, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if userHome == "" {
+		return "", errors.New("the home directory couldn't be found")
+	}
+	return filepath.Join(userHome, home, "gptchat"), nil
+}
@@ -0,0 +1,367 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the format of the config file. The settings at the top level are
+// used by every profile, and the chosen profile's settings are applied on top.
+type File struct {
+	Settings `yaml:",inline"`
+
+	// Profile is the profile used if one isn't chosen
+	Profile  string              `yaml:"profile,omitempty"`
+	Profiles map[string]Settings `yaml:"profiles,omitempty"`
+}
+
+// Settings are the settings in the config file. Anything which isn't set
+// leaves the config as it is.
+type Settings struct {
+	Provider       string            `yaml:"provider,omitempty"`
+	Model          string            `yaml:"model,omitempty"`
+	FallbackModels []string          `yaml:"fallback_models,omitempty"`
+	ModuleModels   map[string]string `yaml:"module_models,omitempty"`
+	Sampling       SamplingSettings  `yaml:"sampling,omitempty"`
+
+	// KeyCommand is a command which prints the API key, and Keyring is
+	// whether the API key can be read from and saved to the system keyring
+	KeyCommand string `yaml:"key_command,omitempty"`
+	Keyring    *bool  `yaml:"keyring,omitempty"`
+
+	Supervised *bool `yaml:"supervised,omitempty"`
+	Tools      *bool `yaml:"tools,omitempty"`
+	Candidates *int  `yaml:"candidates,omitempty"`
+
+	// DataDir is where memories, plugins, saved conversations and usage are
+	// stored, unless their paths are set
+	DataDir string `yaml:"data_dir,omitempty"`
+
+	Context  ContextSettings  `yaml:"context,omitempty"`
+	Retry    RetrySettings    `yaml:"retry,omitempty"`
+	Usage    UsageSettings    `yaml:"usage,omitempty"`
+	Commands CommandSettings  `yaml:"commands,omitempty"`
+	Interval IntervalSettings `yaml:"interval,omitempty"`
+	Memory   MemorySettings   `yaml:"memory,omitempty"`
+	Plugins  PluginSettings   `yaml:"plugins,omitempty"`
+	UI       UISettings       `yaml:"ui,omitempty"`
+}
+
+type SamplingSettings struct {
+	Temperature *float32 `yaml:"temperature,omitempty"`
+	TopP        *float32 `yaml:"top_p,omitempty"`
+	MaxTokens   *int     `yaml:"max_tokens,omitempty"`
+	Stop        []string `yaml:"stop,omitempty"`
+	Seed        *int     `yaml:"seed,omitempty"`
+}
+
+type ContextSettings struct {
+	Budget   *int   `yaml:"budget,omitempty"`
+	Strategy string `yaml:"strategy,omitempty"`
+}
+
+type RetrySettings struct {
+	MaxAttempts *int      `yaml:"max_attempts,omitempty"`
+	BaseDelay   *Duration `yaml:"base_delay,omitempty"`
+	MaxDelay    *Duration `yaml:"max_delay,omitempty"`
+}
+
+type UsageSettings struct {
+	Warn  *float64 `yaml:"warn,omitempty"`
+	Limit *float64 `yaml:"limit,omitempty"`
+}
+
+type CommandSettings struct {
+	MaxAutonomousTurns  *int           `yaml:"max_autonomous_turns,omitempty"`
+	MaxRepeatedCommands *int           `yaml:"max_repeated_commands,omitempty"`
+	Concurrent          *int           `yaml:"concurrent,omitempty"`
+	OutputLimit         *int           `yaml:"output_limit,omitempty"`
+	OutputLimits        map[string]int `yaml:"output_limits,omitempty"`
+	OutputPaging        *bool          `yaml:"output_paging,omitempty"`
+}
+
+type IntervalSettings struct {
+	Turns *int      `yaml:"turns,omitempty"`
+	Time  *Duration `yaml:"time,omitempty"`
+}
+
+type MemorySettings struct {
+	Path string `yaml:"path,omitempty"`
+}
+
+type PluginSettings struct {
+	SourcePath   string `yaml:"source_path,omitempty"`
+	CompiledPath string `yaml:"compiled_path,omitempty"`
+}
+
+type UISettings struct {
+	Theme     string `yaml:"theme,omitempty"`
+	Debug     *bool  `yaml:"debug,omitempty"`
+	Streaming *bool  `yaml:"streaming,omitempty"`
+}
+
+// Duration is a time.Duration which is written like 1s or 5m in the config file
+type Duration time.Duration
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	v, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %s", node.Line, err)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadFile reads a config file. Settings the file doesn't know about are an
+// error, so typos don't go unnoticed.
+func LoadFile(path string) (*File, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var f File
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	// an empty file is fine, it just doesn't change anything
+	if err := decoder.Decode(&f); err != nil && len(bytes.TrimSpace(b)) > 0 {
+		return nil, fmt.Errorf("error parsing %s: %s", path, err)
+	}
+	return &f, nil
+}
+
+// Apply applies the settings in the file to c, followed by the settings in
+// profile, or the file's default profile if profile is empty
+func (f *File) Apply(c Config, profile string) (Config, error) {
+	c = f.Settings.Apply(c)
+
+	if profile == "" {
+		profile = f.Profile
+	}
+	if profile == "" {
+		return c, nil
+	}
+	settings, ok := f.Profiles[profile]
+	if !ok {
+		return c, fmt.Errorf("profile %s isn't in the config file", profile)
+	}
+	return settings.Apply(c), nil
+}
+
+// Apply returns c with the settings which have been set
+func (s Settings) Apply(c Config) Config {
+	if s.Provider != "" {
+		c = c.WithProvider(s.Provider)
+	}
+	if s.Model != "" {
+		c = c.WithOpenAIAPIModel(s.Model)
+	}
+	if s.FallbackModels != nil {
+		c = c.WithFallbackModels(s.FallbackModels...)
+	}
+	for module, model := range s.ModuleModels {
+		c = c.WithModuleModel(module, model)
+	}
+
+	sampling := c.Sampling()
+	if s.Sampling.Temperature != nil {
+		sampling.Temperature = s.Sampling.Temperature
+	}
+	if s.Sampling.TopP != nil {
+		sampling.TopP = s.Sampling.TopP
+	}
+	if s.Sampling.MaxTokens != nil {
+		sampling.MaxTokens = *s.Sampling.MaxTokens
+	}
+	if s.Sampling.Stop != nil {
+		sampling.Stop = s.Sampling.Stop
+	}
+	if s.Sampling.Seed != nil {
+		sampling.Seed = s.Sampling.Seed
+	}
+	c = c.WithSampling(sampling)
+
+	if s.KeyCommand != "" {
+		c = c.WithKeyCommand(s.KeyCommand)
+	}
+	if s.Keyring != nil {
+		c = c.WithKeyring(*s.Keyring)
+	}
+
+	if s.Supervised != nil {
+		c = c.WithSupervisedMode(*s.Supervised)
+	}
+	if s.Tools != nil {
+		c = c.WithToolsMode(*s.Tools)
+	}
+	if s.Candidates != nil {
+		c = c.WithCandidates(*s.Candidates)
+	}
+
+	if s.Context.Budget != nil {
+		c = c.WithContextBudget(*s.Context.Budget)
+	}
+	if s.Context.Strategy != "" {
+		c = c.WithContextStrategy(s.Context.Strategy)
+	}
+
+	if s.Retry.MaxAttempts != nil {
+		c = c.WithRetryMaxAttempts(*s.Retry.MaxAttempts)
+	}
+	if s.Retry.BaseDelay != nil {
+		c = c.WithRetryBaseDelay(time.Duration(*s.Retry.BaseDelay))
+	}
+	if s.Retry.MaxDelay != nil {
+		c = c.WithRetryMaxDelay(time.Duration(*s.Retry.MaxDelay))
+	}
+
+	if s.Usage.Warn != nil {
+		c = c.WithUsageWarnLimit(*s.Usage.Warn)
+	}
+	if s.Usage.Limit != nil {
+		c = c.WithUsageLimit(*s.Usage.Limit)
+	}
+
+	if s.Commands.MaxAutonomousTurns != nil {
+		c = c.WithMaxAutonomousTurns(*s.Commands.MaxAutonomousTurns)
+	}
+	if s.Commands.MaxRepeatedCommands != nil {
+		c = c.WithMaxRepeatedCommands(*s.Commands.MaxRepeatedCommands)
+	}
+	if s.Commands.Concurrent != nil {
+		c = c.WithConcurrentCommands(*s.Commands.Concurrent)
+	}
+	if s.Commands.OutputLimit != nil {
+		c = c.WithOutputLimit(*s.Commands.OutputLimit)
+	}
+	for module, limit := range s.Commands.OutputLimits {
+		c = c.WithModuleOutputLimit(module, limit)
+	}
+	if s.Commands.OutputPaging != nil {
+		c = c.WithOutputPaging(*s.Commands.OutputPaging)
+	}
+
+	if s.Interval.Turns != nil {
+		c = c.WithIntervalPromptTurns(*s.Interval.Turns)
+	}
+	if s.Interval.Time != nil {
+		c = c.WithIntervalPromptTime(time.Duration(*s.Interval.Time))
+	}
+
+	if s.DataDir != "" {
+		c = c.WithDataDir(s.DataDir)
+	}
+	if s.Memory.Path != "" {
+		c = c.WithMemoryPath(s.Memory.Path)
+	}
+	if s.Plugins.SourcePath != "" {
+		c = c.WithPluginSourcePath(s.Plugins.SourcePath)
+	}
+	if s.Plugins.CompiledPath != "" {
+		c = c.WithPluginCompiledPath(s.Plugins.CompiledPath)
+	}
+
+	if s.UI.Theme != "" {
+		c = c.WithTheme(s.UI.Theme)
+	}
+	if s.UI.Debug != nil {
+		c = c.WithDebugMode(*s.UI.Debug)
+	}
+	if s.UI.Streaming != nil {
+		c = c.WithStreamingMode(*s.UI.Streaming)
+	}
+
+	return c
+}
+
+// Settings returns every setting in c, in the same format as the config
+// file. The API key is never included, since it isn't part of the config.
+func (c Config) Settings() Settings {
+	sampling := c.Sampling()
+	maxTokens := sampling.MaxTokens
+	retryBaseDelay, retryMaxDelay := Duration(c.retryBaseDelay), Duration(c.retryMaxDelay)
+	intervalTime := Duration(c.intervalPromptTime)
+
+	outputLimits := make(map[string]int, len(c.moduleOutputLimits))
+	for module, limit := range c.moduleOutputLimits {
+		outputLimits[module] = limit
+	}
+
+	return Settings{
+		Provider:       c.provider,
+		Model:          c.openaiAPIModel,
+		FallbackModels: c.FallbackModels(),
+		ModuleModels:   c.ModuleModels(),
+		Sampling: SamplingSettings{
+			Temperature: sampling.Temperature,
+			TopP:        sampling.TopP,
+			MaxTokens:   &maxTokens,
+			Stop:        sampling.Stop,
+			Seed:        sampling.Seed,
+		},
+		KeyCommand: c.keyCommand,
+		Keyring:    boolPtr(c.keyring),
+		DataDir:    c.dataDir,
+		Supervised: boolPtr(c.supervisedMode),
+		Tools:      boolPtr(c.toolsMode),
+		Candidates: intPtr(c.candidates),
+		Context: ContextSettings{
+			Budget:   intPtr(c.contextBudget),
+			Strategy: c.contextStrategy,
+		},
+		Retry: RetrySettings{
+			MaxAttempts: intPtr(c.retryMaxAttempts),
+			BaseDelay:   &retryBaseDelay,
+			MaxDelay:    &retryMaxDelay,
+		},
+		Usage: UsageSettings{
+			Warn:  float64Ptr(c.usageWarnLimit),
+			Limit: float64Ptr(c.usageLimit),
+		},
+		Commands: CommandSettings{
+			MaxAutonomousTurns:  intPtr(c.maxAutonomousTurns),
+			MaxRepeatedCommands: intPtr(c.maxRepeatedCommands),
+			Concurrent:          intPtr(c.concurrentCommands),
+			OutputLimit:         intPtr(c.outputLimit),
+			OutputLimits:        outputLimits,
+			OutputPaging:        boolPtr(c.outputPaging),
+		},
+		Interval: IntervalSettings{
+			Turns: intPtr(c.intervalPromptTurns),
+			Time:  &intervalTime,
+		},
+		Memory: MemorySettings{
+			Path: c.MemoryPath(),
+		},
+		Plugins: PluginSettings{
+			SourcePath:   c.PluginSourcePath(),
+			CompiledPath: c.PluginCompiledPath(),
+		},
+		UI: UISettings{
+			Theme:     c.theme,
+			Debug:     boolPtr(c.debugMode),
+			Streaming: boolPtr(c.streamingMode),
+		},
+	}
+}
+
+// YAML returns every setting in c in the format of the config file
+func (c Config) YAML() (string, error) {
+	b, err := yaml.Marshal(c.Settings())
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+func boolPtr(v bool) *bool          { return &v }
+func intPtr(v int) *int             { return &v }
+func float64Ptr(v float64) *float64 { return &v }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "gptchat.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	f, err := LoadFile(writeFile(t, `
+model: gpt-4
+retry:
+  max_attempts: 3
+  base_delay: 2s
+memory:
+  path: /tmp/memories.json
+profile: work
+profiles:
+  work:
+    model: gpt-4-turbo
+    sampling:
+      temperature: 0.2
+  local:
+    provider: openai-compatible
+    model: llama3
+    ui:
+      theme: dark
+`))
+	require.NoError(t, err)
+
+	// the default profile is applied on top of the top level settings
+	cfg, err := f.Apply(New(), "")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4-turbo", cfg.OpenAIAPIModel())
+	assert.Equal(t, float32(0.2), *cfg.Sampling().Temperature)
+	assert.Equal(t, 3, cfg.RetryMaxAttempts())
+	assert.Equal(t, 2*time.Second, cfg.RetryBaseDelay())
+	assert.Equal(t, "/tmp/memories.json", cfg.MemoryPath())
+	require.NoError(t, cfg.Validate())
+
+	cfg, err = f.Apply(New(), "local")
+	require.NoError(t, err)
+	assert.Equal(t, "openai-compatible", cfg.Provider())
+	assert.Equal(t, "llama3", cfg.OpenAIAPIModel())
+	assert.Equal(t, "dark", cfg.Theme())
+	assert.Nil(t, cfg.Sampling().Temperature)
+
+	_, err = f.Apply(New(), "missing")
+	assert.Error(t, err)
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	_, err := LoadFile(writeFile(t, "modle: gpt-4\n"))
+	assert.Error(t, err)
+
+	_, err = LoadFile(writeFile(t, "retry:\n  base_delay: soon\n"))
+	assert.Error(t, err)
+
+	f, err := LoadFile(writeFile(t, ""))
+	require.NoError(t, err)
+	cfg, err := f.Apply(New(), "")
+	require.NoError(t, err)
+	assert.Equal(t, New(), cfg)
+
+	f, err = LoadFile(writeFile(t, "commands:\n  concurrent: 0\n"))
+	require.NoError(t, err)
+	cfg, err = f.Apply(New().WithOpenAIAPIModel("gpt-4"), "")
+	require.NoError(t, err)
+	assert.Error(t, cfg.Validate())
+
+	for _, sampling := range []string{"temperature: -1", "top_p: -0.5"} {
+		f, err = LoadFile(writeFile(t, "sampling:\n  "+sampling+"\n"))
+		require.NoError(t, err)
+		cfg, err = f.Apply(New().WithOpenAIAPIModel("gpt-4"), "")
+		require.NoError(t, err)
+		assert.Error(t, cfg.Validate(), sampling)
+	}
+}
+
+func TestYAML(t *testing.T) {
+	cfg := New().
+		WithOpenAIAPIModel("gpt-4").
+		WithModuleModel("memory", "gpt-3.5-turbo").
+		WithModuleOutputLimit("plugin", 2000).
+		WithIntervalPromptTime(10 * time.Minute).
+		WithTheme("dark")
+	cfg, err := cfg.WithSamplingParameter("seed", "42")
+	require.NoError(t, err)
+
+	settings, err := cfg.YAML()
+	require.NoError(t, err)
+	assert.Contains(t, settings, "time: 10m0s")
+
+	// the settings can be loaded back in as a config file
+	f, err := LoadFile(writeFile(t, settings))
+	require.NoError(t, err)
+	loaded, err := f.Apply(New(), "")
+	require.NoError(t, err)
+	reloaded, err := loaded.YAML()
+	require.NoError(t, err)
+	assert.Equal(t, settings, reloaded)
+	assert.Equal(t, "memories.json", loaded.MemoryPath())
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SamplingParameters are the names of the sampling parameters which can be set
+// using WithSamplingParameter
+var SamplingParameters = []string{"temperature", "top_p", "max_tokens", "stop", "seed"}
+
+// WithSamplingParameter sets a sampling parameter by name from a string, for
+// example from an environment variable or a slash command. If value is empty
+// or "default", the parameter goes back to the API's default.
+//
+// Stop sequences are separated by commas, and can use escapes like \n.
+func (c Config) WithSamplingParameter(name, value string) (Config, error) {
+	value = strings.TrimSpace(value)
+	unset := value == "" || value == "default"
+
+	sampling := c.sampling
+	switch name {
+	case "temperature", "top_p":
+		var f *float32
+		if !unset {
+			v, err := strconv.ParseFloat(value, 32)
+			if err != nil || v < 0 {
+				return c, fmt.Errorf("%s must be a number which isn't negative: %s", name, value)
+			}
+			v32 := float32(v)
+			f = &v32
+		}
+		if name == "temperature" {
+			sampling.Temperature = f
+		} else {
+			sampling.TopP = f
+		}
+
+	case "max_tokens":
+		sampling.MaxTokens = 0
+		if !unset {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return c, fmt.Errorf("max_tokens must be a whole number which isn't negative: %s", value)
+			}
+			sampling.MaxTokens = n
+		}
+
+	case "stop":
+		sampling.Stop = nil
+		if !unset {
+			for _, stop := range strings.Split(value, ",") {
+				// escapes are optional, so anything which isn't valid is used as it is
+				if unquoted, err := strconv.Unquote(`"` + stop + `"`); err == nil {
+					stop = unquoted
+				}
+				if stop != "" {
+					sampling.Stop = append(sampling.Stop, stop)
+				}
+			}
+		}
+
+	case "seed":
+		sampling.Seed = nil
+		if !unset {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return c, fmt.Errorf("seed must be a whole number: %s", value)
+			}
+			sampling.Seed = &n
+		}
+
+	default:
+		return c, fmt.Errorf("unknown parameter %s, it must be one of %s", name, strings.Join(SamplingParameters, ", "))
+	}
+
+	c.sampling = sampling
+	return c, nil
+}
+
+// SamplingParameter returns the value of a sampling parameter as a string,
+// or "default" if it isn't set
+func (c Config) SamplingParameter(name string) string {
+	s := c.sampling
+	switch {
+	case name == "temperature" && s.Temperature != nil:
+		return strconv.FormatFloat(float64(*s.Temperature), 'g', -1, 32)
+	case name == "top_p" && s.TopP != nil:
+		return strconv.FormatFloat(float64(*s.TopP), 'g', -1, 32)
+	case name == "max_tokens" && s.MaxTokens != 0:
+		return strconv.Itoa(s.MaxTokens)
+	case name == "stop" && len(s.Stop) > 0:
+		var stops []string
+		for _, stop := range s.Stop {
+			stops = append(stops, strings.Trim(strconv.Quote(stop), `"`))
+		}
+		return strings.Join(stops, ",")
+	case name == "seed" && s.Seed != nil:
+		return strconv.Itoa(*s.Seed)
+	}
+	return "default"
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSamplingParameter(t *testing.T) {
+	cfg := New()
+	for _, name := range SamplingParameters {
+		assert.Equal(t, "default", cfg.SamplingParameter(name))
+	}
+
+	var err error
+	cfg, err = cfg.WithSamplingParameter("temperature", "0.2")
+	require.NoError(t, err)
+	cfg, err = cfg.WithSamplingParameter("stop", `END,\n`)
+	require.NoError(t, err)
+	cfg, err = cfg.WithSamplingParameter("seed", "42")
+	require.NoError(t, err)
+
+	assert.Equal(t, float32(0.2), *cfg.Sampling().Temperature)
+	assert.Equal(t, []string{"END", "\n"}, cfg.Sampling().Stop)
+	assert.Equal(t, "0.2", cfg.SamplingParameter("temperature"))
+	assert.Equal(t, `END,\n`, cfg.SamplingParameter("stop"))
+	assert.Equal(t, "42", cfg.SamplingParameter("seed"))
+
+	cfg, err = cfg.WithSamplingParameter("temperature", "default")
+	require.NoError(t, err)
+	assert.Nil(t, cfg.Sampling().Temperature)
+
+	_, err = cfg.WithSamplingParameter("max_tokens", "-1")
+	assert.Error(t, err)
+	_, err = cfg.WithSamplingParameter("frequency_penalty", "1")
+	assert.Error(t, err)
+}
+
+func TestModuleModel(t *testing.T) {
+	cfg := New().WithOpenAIAPIModel("gpt-4")
+	memory := cfg.WithModuleModel("memory", "gpt-3.5-turbo")
+
+	assert.Equal(t, "gpt-3.5-turbo", memory.ModuleModel("memory"))
+	assert.Equal(t, "gpt-4", memory.ModuleModel("plugin"))
+	// the original config isn't changed
+	assert.Equal(t, "gpt-4", cfg.ModuleModel("memory"))
+	assert.Equal(t, "gpt-4", memory.WithModuleModel("memory", "").ModuleModel("memory"))
+}
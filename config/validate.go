@@ -0,0 +1,59 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validate returns an error describing the first setting which isn't valid
+func (c Config) Validate() error {
+	switch {
+	case !contains(Providers, c.provider):
+		return fmt.Errorf("provider must be one of %s: %s", strings.Join(Providers, ", "), c.provider)
+	case c.openaiAPIModel == "":
+		return errors.New("model can't be empty")
+	case c.contextStrategy != ContextStrategyDrop && c.contextStrategy != ContextStrategySummarise:
+		return fmt.Errorf("context strategy must be %s or %s: %s", ContextStrategyDrop, ContextStrategySummarise, c.contextStrategy)
+	case c.contextBudget < 0:
+		return fmt.Errorf("context budget can't be negative: %d", c.contextBudget)
+	case c.retryMaxAttempts < 1:
+		return fmt.Errorf("retry max attempts must be at least 1: %d", c.retryMaxAttempts)
+	case c.retryBaseDelay < 0 || c.retryMaxDelay < 0:
+		return errors.New("retry delays can't be negative")
+	case c.usageWarnLimit < 0 || c.usageLimit < 0:
+		return errors.New("usage limits can't be negative")
+	case c.maxAutonomousTurns < 0 || c.maxRepeatedCommands < 0:
+		return errors.New("max autonomous turns and max repeated commands can't be negative")
+	case c.intervalPromptTurns < 0 || c.intervalPromptTime < 0:
+		return errors.New("the interval prompt turns and time can't be negative")
+	case c.concurrentCommands < 1:
+		return fmt.Errorf("concurrent commands must be at least 1: %d", c.concurrentCommands)
+	case c.outputLimit < 0:
+		return fmt.Errorf("output limit can't be negative: %d", c.outputLimit)
+	case c.candidates < 1:
+		return fmt.Errorf("candidates must be at least 1: %d", c.candidates)
+	case c.sampling.Temperature != nil && (*c.sampling.Temperature < 0 || *c.sampling.Temperature > 2):
+		return fmt.Errorf("temperature must be between 0 and 2: %g", *c.sampling.Temperature)
+	case c.sampling.TopP != nil && (*c.sampling.TopP < 0 || *c.sampling.TopP > 1):
+		return fmt.Errorf("top_p must be between 0 and 1: %g", *c.sampling.TopP)
+	case !contains(Themes, c.theme):
+		return fmt.Errorf("theme must be one of %s: %s", strings.Join(Themes, ", "), c.theme)
+	}
+
+	for module, limit := range c.moduleOutputLimits {
+		if limit < 0 {
+			return fmt.Errorf("output limit for %s can't be negative: %d", module, limit)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
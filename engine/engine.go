@@ -0,0 +1,385 @@
+// Package engine runs a conversation with GPT one turn at a time, using
+// input and output interfaces, so the terminal is just one front end
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/session"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/ian-kent/gptchat/usage"
+)
+
+// Input is where the engine gets input from the user
+type Input interface {
+	// Read returns the user's next message, or io.EOF once there are no more
+	Read() (string, error)
+	// Confirm asks the user a yes or no question
+	Confirm(question string) bool
+	// Choose asks the user to choose between n options, and returns the
+	// option they chose, from 0 to n-1
+	Choose(question string, n int) int
+}
+
+// Output is where the engine shows the user what's happening.
+//
+// The name of each message is one of the ui names, for example ui.AI.
+type Output interface {
+	Chat(name, message string)
+	Debug(name, message string)
+	Info(message string)
+	Error(message string, err error)
+	// Stream returns a stream to display a response as it's generated. If
+	// hideCommands is true, the commands in the response shouldn't be shown.
+	Stream(name string, hideCommands bool) session.Stream
+}
+
+// State is what the engine is doing
+type State int
+
+const (
+	// StateWaiting is waiting for input from the user
+	StateWaiting State = iota
+	// StateRequesting is waiting for a response from GPT
+	StateRequesting
+	// StateExecuting is executing the commands GPT used
+	StateExecuting
+	// StateConfirming is waiting for the user to answer a question
+	StateConfirming
+)
+
+func (s State) String() string {
+	switch s {
+	case StateWaiting:
+		return "waiting"
+	case StateRequesting:
+		return "requesting"
+	case StateExecuting:
+		return "executing"
+	case StateConfirming:
+		return "confirming"
+	default:
+		return "unknown"
+	}
+}
+
+// Hooks are called as a turn progresses, any of them can be nil
+type Hooks struct {
+	// Input is called with each message from the user, and returns true if it
+	// handled the message, for example a slash command meant for the front end
+	Input func(e *Engine, input string) bool
+
+	// StateChange is called whenever the state changes
+	StateChange func(e *Engine, state State)
+
+	// BeforeRequest is called before each request to GPT
+	BeforeRequest func(e *Engine)
+	// AfterResponse is called with each response from GPT
+	AfterResponse func(e *Engine, response provider.Message)
+
+	// BeforeCommand is called before each command GPT uses is executed. If
+	// commands are executed concurrently, so are the command hooks.
+	BeforeCommand func(e *Engine, command, args, body string)
+	// AfterCommand is called after each command is executed, with its output or error
+	AfterCommand func(e *Engine, command, output, err string)
+}
+
+// Engine runs a conversation, taking turns with GPT until GPT stops using commands
+type Engine struct {
+	Input  Input
+	Output Output
+	Hooks  Hooks
+
+	// Context returns the context for each turn, and a func to call once the
+	// turn is finished. Cancelling the context cancels the turn.
+	Context func() (context.Context, func())
+
+	chat  *session.Session
+	state State
+
+	// approvals asks the user to approve one action at a time, since
+	// commands can be executed concurrently
+	approvals sync.Mutex
+}
+
+// New returns an engine for a new conversation which uses client to talk to GPT,
+// and modules to execute commands
+func New(cfg config.Config, client provider.Provider, modules *module.Registry, in Input, out Output) *Engine {
+	return &Engine{
+		Input:  in,
+		Output: out,
+		Context: func() (context.Context, func()) {
+			return context.WithCancel(context.Background())
+		},
+		chat: session.New(cfg, client, modules),
+	}
+}
+
+// Session returns the conversation, for example to save or load it
+func (e *Engine) Session() *session.Session {
+	return e.chat
+}
+
+// State returns what the engine is doing
+func (e *Engine) State() State {
+	return e.state
+}
+
+func (e *Engine) setState(state State) {
+	e.state = state
+	if e.Hooks.StateChange != nil {
+		e.Hooks.StateChange(e, state)
+	}
+}
+
+// Run starts the conversation, and sends each message from the user to GPT
+// until there are no more
+func (e *Engine) Run() error {
+	e.Start()
+
+	for {
+		e.setState(StateWaiting)
+		input, err := e.Input.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.Hooks.Input != nil && e.Hooks.Input(e, input) {
+			continue
+		}
+		e.Send(input)
+	}
+}
+
+// Start adds the system prompt to a new conversation, and gives GPT a turn if it
+// needs to familiarise itself with the commands. It does nothing if the conversation
+// has already started, for example if it's been loaded.
+func (e *Engine) Start() {
+	if len(e.chat.Messages()) > 0 {
+		return
+	}
+	if !e.chat.Start(session.WithEvents(context.Background(), e.event)) {
+		return
+	}
+
+	if !e.chat.Config().IsDebugMode() {
+		e.Output.Chat(ui.App, "Setting up the chat environment, please wait for GPT to respond - this may take a few moments.")
+	}
+	e.turn(1)
+}
+
+// Reset starts a new conversation
+func (e *Engine) Reset() {
+	e.chat.Reset()
+	e.Start()
+}
+
+// Send sends a message from the user to GPT
+func (e *Engine) Send(message string) {
+	e.chat.AppendMessage(provider.RoleUser, message)
+	e.turn(e.chat.Config().Candidates())
+}
+
+// Retry sends the conversation to GPT again, without adding anything to it
+func (e *Engine) Retry() {
+	e.turn(1)
+}
+
+// Regenerate removes GPT's last turn from the conversation, including the output
+// of any commands it used, and asks GPT to respond again. If candidates is more
+// than 1, the user chooses which of the responses to keep.
+func (e *Engine) Regenerate(candidates int) {
+	e.chat.DropLastTurn()
+	e.turn(candidates)
+}
+
+// Undo removes the user's last message, and everything after it, from the
+// conversation. The old version is kept as a branch. It returns false if
+// there's nothing to undo.
+func (e *Engine) Undo() bool {
+	return e.chat.Undo()
+}
+
+// Edit starts a new branch where the user's nth message is replaced by
+// message, and sends it to GPT
+func (e *Engine) Edit(n int, message string) error {
+	if err := e.chat.EditMessage(n, message); err != nil {
+		return err
+	}
+	e.turn(e.chat.Config().Candidates())
+	return nil
+}
+
+// turn requests responses from GPT and executes the commands it uses, until
+// GPT is waiting for the user, or the turn is cancelled. The user chooses
+// between candidates for the first response, if there's more than one.
+func (e *Engine) turn(candidates int) {
+	ctx, done := e.Context()
+	defer done()
+
+	// commands are reported using events, responses are streamed to the output,
+	// and the user is asked to approve actions using the input
+	ctx = session.WithEvents(ctx, e.event)
+	ctx = module.WithApprover(ctx, e)
+	ctx = session.WithStream(ctx, func() session.Stream {
+		cfg := e.chat.Config()
+		return e.Output.Stream(ui.AI, !cfg.IsDebugMode() && !cfg.IsToolsMode())
+	})
+
+	// the user chooses between candidates for the first response
+	var chosen bool
+	hooks := session.TurnHooks{
+		BeforeRequest: func() {
+			e.setState(StateRequesting)
+			if e.Hooks.BeforeRequest != nil {
+				e.Hooks.BeforeRequest(e)
+			}
+		},
+		Request: func(ctx context.Context) (provider.Message, error) {
+			if candidates <= 1 {
+				chosen = false
+				return e.chat.RequestCompletion(ctx)
+			}
+			response, err := e.requestCandidates(ctx, candidates)
+			if err == nil {
+				candidates, chosen = 1, true
+			}
+			return response, err
+		},
+		RequestFailed: e.requestFailed,
+		Response: func(response provider.Message, chat string) {
+			cfg := e.chat.Config()
+			// streamed responses and candidates have already been shown, and
+			// in debug mode the full response is shown using a debug event
+			if !cfg.IsDebugMode() && !cfg.IsStreamingMode() && !chosen && chat != "" {
+				e.Output.Chat(ui.AI, chat)
+			}
+			// with fallbacks, the model which answered might not be the one the user chose
+			if len(cfg.FallbackModels()) > 0 && response.Model != "" {
+				e.Output.Info(fmt.Sprintf("Answered by %s", response.Model))
+			}
+			if e.Hooks.AfterResponse != nil {
+				e.Hooks.AfterResponse(e, response)
+			}
+			e.setState(StateExecuting)
+		},
+		Loop: e.checkLoop,
+	}
+
+	// the hooks have already told the user about anything which went wrong
+	e.chat.RunTurn(ctx, hooks)
+	if ctx.Err() != nil && e.state == StateExecuting {
+		e.Output.Info("The command was cancelled")
+	}
+}
+
+// requestFailed tells the user a request failed, and returns true if they'd like to try again
+func (e *Engine) requestFailed(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		e.Output.Info("The request was cancelled")
+		return false
+	}
+
+	e.Output.Error("ChatCompletion failed", err)
+	// trying again won't help until the limit is raised
+	if errors.Is(err, usage.ErrLimitExceeded) {
+		return false
+	}
+	return e.confirm("Would you like to try again?")
+}
+
+// requestCandidates asks GPT for n responses, and asks the user which one to keep
+func (e *Engine) requestCandidates(ctx context.Context, n int) (provider.Message, error) {
+	candidates, err := e.chat.RequestCandidates(ctx, n)
+	if err != nil {
+		return provider.Message{}, err
+	}
+	return e.choose(candidates), nil
+}
+
+// choose shows the user each candidate, including any commands it uses, and
+// returns the one they choose to keep
+func (e *Engine) choose(candidates []provider.Message) provider.Message {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	for i, candidate := range candidates {
+		content := strings.TrimSpace(candidate.Content)
+		for _, toolCall := range candidate.ToolCalls {
+			content += fmt.Sprintf("\n/%s %s", toolCall.Name, toolCall.Arguments)
+		}
+		e.Output.Chat(ui.AI, fmt.Sprintf("Response %d of %d:\n\n%s", i+1, len(candidates), strings.TrimSpace(content)))
+	}
+
+	previous := e.state
+	e.setState(StateConfirming)
+	defer e.setState(previous)
+
+	choice := e.Input.Choose("Which response would you like to keep?", len(candidates))
+	if choice < 0 || choice >= len(candidates) {
+		choice = 0
+	}
+	return candidates[choice]
+}
+
+// checkLoop asks the user whether GPT can carry on using commands,
+// since it looks like GPT is stuck
+func (e *Engine) checkLoop(loopErr *session.LoopError) bool {
+	e.Output.Chat(ui.App, loopErr.Summary())
+	return e.confirm("Would you like GPT to continue?")
+}
+
+func (e *Engine) confirm(question string) bool {
+	previous := e.state
+	e.setState(StateConfirming)
+	defer e.setState(previous)
+	return e.Input.Confirm(question)
+}
+
+// Approve implements module.Approver, by showing the user what needs their
+// approval and asking them to confirm it
+func (e *Engine) Approve(ctx context.Context, req module.ApprovalRequest) error {
+	e.approvals.Lock()
+	defer e.approvals.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	e.Output.Chat(ui.App, req.Warning+"\n\n"+req.Details)
+	if !e.confirm("Would you like to allow this?") {
+		return module.ErrNotApproved
+	}
+	return nil
+}
+
+// event calls the command hooks, and shows retries, warnings and debug output
+func (e *Engine) event(ev session.Event) {
+	switch ev.Type {
+	case session.EventRetry:
+		e.Output.Error(ev.Content, errors.New(ev.Error))
+	case session.EventWarning:
+		e.Output.Info(ev.Content)
+	case session.EventDebug:
+		e.Output.Debug(ev.Name, ev.Content)
+	case session.EventCommand:
+		if e.Hooks.BeforeCommand != nil {
+			e.Hooks.BeforeCommand(e, ev.Command, ev.Args, ev.Body)
+		}
+	case session.EventCommandResult:
+		if e.Hooks.AfterCommand != nil {
+			e.Hooks.AfterCommand(e, ev.Command, ev.Content, ev.Error)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEngine(t *testing.T) {
+	s := &script{
+		inputs:  []string{"Do something", "/secret", "Fail"},
+		answers: []bool{true},
+	}
+	e, fake := newTestEngine(t, s, "Let me check.\n/help", "Done.")
+	fake.Fail(&provider.Error{StatusCode: 400, Err: assert.AnError})
+	fake.Respond("Try again.")
+	e.Session().SetConfig(e.Session().Config().WithRetryMaxAttempts(1))
+
+	var states []State
+	var commands []string
+	e.Hooks.Input = func(e *Engine, input string) bool {
+		return input == "/secret"
+	}
+	e.Hooks.StateChange = func(e *Engine, state State) {
+		if len(states) == 0 || states[len(states)-1] != state {
+			states = append(states, state)
+		}
+	}
+	e.Hooks.BeforeCommand = func(e *Engine, command, args, body string) {
+		commands = append(commands, command)
+	}
+
+	require.NoError(t, e.Run())
+
+	assert.Equal(t, []string{
+		"APP: Setting up the chat environment, please wait for GPT to respond - this may take a few moments.",
+		"AI: I'm ready.",
+		"AI: Let me check.",
+		"AI: Done.",
+		"ERROR: ChatCompletion failed",
+		"? Would you like to try again?",
+		"AI: Try again.",
+	}, s.chat)
+	assert.Equal(t, []string{"/help", "/help"}, commands)
+	assert.Equal(t, StateWaiting, e.State())
+	assert.Contains(t, states, StateConfirming)
+
+	// the slash command was handled by the front end, so GPT never saw it
+	for _, req := range fake.Requests() {
+		for _, message := range req.Messages {
+			assert.NotEqual(t, "/secret", message.Content)
+		}
+	}
+}
+
+func TestRegenerate(t *testing.T) {
+	s := &script{choices: []int{1}}
+	e, fake := newTestEngine(t, s, "Let me check.\n/help", "Done.", "Hi!", "Hey!", "/help")
+	e.Session().SetConfig(e.Session().Config().WithIntervalPromptTurns(0))
+
+	e.Start()
+	e.Send("Hi")
+	require.Len(t, e.Session().Messages(), 9)
+
+	// the responses and the command output are dropped, and the user chooses the second candidate
+	e.Regenerate(3)
+	messages := e.Session().Messages()
+	require.Len(t, messages, 7)
+	assert.Equal(t, "Hi", messages[5].Content)
+	assert.Equal(t, "Hey!", messages[6].Content)
+
+	requests := fake.Requests()
+	require.Len(t, requests, 5)
+	assert.Equal(t, 3, requests[4].N)
+	assert.Len(t, requests[4].Messages, 6)
+
+	assert.Equal(t, []string{
+		"AI: Response 1 of 3:\n\nHi!",
+		"AI: Response 2 of 3:\n\nHey!",
+		"AI: Response 3 of 3:\n\n/help",
+		"? Which response would you like to keep?",
+	}, s.chat[len(s.chat)-4:])
+}
+
+func TestLoop(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	fake := provider.NewFake("/help", "/help", "/help")
+	s := &script{answers: []bool{true, false}}
+	cfg := config.New().WithOpenAIAPIModel("gpt-4").WithMaxAutonomousTurns(1)
+	e := New(cfg, fake, module.NewRegistry(), s, s)
+
+	// GPT carries on the first time, but stops once the user says no
+	e.Send("Help")
+	assert.Len(t, fake.Requests(), 2)
+	assert.Equal(t, []string{
+		"APP: GPT has used commands 1 times in a row.\n\nGPT has taken 1 turns without any input from you, using these commands:\n\n    /help",
+		"? Would you like GPT to continue?",
+		"APP: GPT has used commands 1 times in a row.\n\nGPT has taken 1 turns without any input from you, using these commands:\n\n    /help",
+		"? Would you like GPT to continue?",
+	}, s.chat)
+}
+
+func TestAnsweredBy(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	fake := provider.NewFake().Fail(&provider.Error{StatusCode: 404, Err: assert.AnError}).Respond("Hi!")
+	client := provider.NewFallback(fake, provider.FallbackEntry{Model: "gpt-3.5-turbo"})
+	s := &script{}
+	cfg := config.New().WithOpenAIAPIModel("gpt-4").WithToolsMode(true).WithFallbackModels("gpt-3.5-turbo")
+	e := New(cfg, client, module.NewRegistry(), s, s)
+
+	e.Send("Hi")
+	assert.Equal(t, []string{"AI: Hi!", "INFO: Answered by gpt-3.5-turbo"}, s.chat)
+	assert.Equal(t, "gpt-3.5-turbo", e.Session().Transcript()[1].Model)
+}
+
+func TestRetryIsReported(t *testing.T) {
+	s := &script{}
+	e, fake := newTestEngine(t, s)
+	fake.Fail(&provider.Error{StatusCode: 502, Err: assert.AnError})
+	fake.Respond("Hi!")
+	e.Session().SetConfig(e.Session().Config().WithRetryBaseDelay(time.Millisecond))
+
+	e.Start()
+	e.Send("Hi")
+
+	require.Len(t, s.chat, 4)
+	assert.True(t, strings.HasPrefix(s.chat[2], "ERROR: request failed, trying again in"), s.chat[2])
+	assert.Equal(t, "AI: Hi!", s.chat[3])
+}
+
+// approvalModule asks the user to approve each command
+type approvalModule struct{}
+
+func (approvalModule) Load(config.Config, provider.Provider) error { return nil }
+func (approvalModule) UpdateConfig(config.Config)                  {}
+func (approvalModule) ID() string                                  { return "approve" }
+func (approvalModule) Prompt() string                              { return "" }
+func (approvalModule) Execute(ctx context.Context, args, body string) (string, error) {
+	err := module.Approve(ctx, module.ApprovalRequest{Warning: "Careful", Details: args})
+	if err != nil {
+		return "", err
+	}
+	return "approved", nil
+}
+
+func TestApprove(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	modules := module.NewRegistry()
+	cfg := config.New().WithOpenAIAPIModel("gpt-4")
+	require.NoError(t, modules.Load(cfg, nil, approvalModule{}))
+
+	fake := provider.NewFake("/approve first", "/approve second", "Done.")
+	s := &script{answers: []bool{true, false}}
+	e := New(cfg, fake, modules, s, s)
+
+	e.Send("Hi")
+	assert.Equal(t, []string{
+		"APP: Careful\n\nfirst",
+		"? Would you like to allow this?",
+		"APP: Careful\n\nsecond",
+		"? Would you like to allow this?",
+		"AI: Done.",
+	}, s.chat)
+
+	requests := fake.Requests()
+	require.Len(t, requests, 3)
+	assert.Contains(t, requests[1].Messages[len(requests[1].Messages)-1].Content, "The output was:\n\napproved")
+	assert.Contains(t, requests[2].Messages[len(requests[2].Messages)-1].Content, module.ErrNotApproved.Error())
+}
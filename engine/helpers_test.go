@@ -0,0 +1,65 @@
+package engine
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/session"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// script is an Input and Output which reads scripted input, and records the output
+type script struct {
+	inputs  []string
+	answers []bool
+	choices []int
+	chat    []string
+}
+
+func (s *script) Read() (string, error) {
+	if len(s.inputs) == 0 {
+		return "", io.EOF
+	}
+	input := s.inputs[0]
+	s.inputs = s.inputs[1:]
+	return input, nil
+}
+
+func (s *script) Confirm(question string) bool {
+	s.chat = append(s.chat, "? "+question)
+	answer := s.answers[0]
+	s.answers = s.answers[1:]
+	return answer
+}
+
+func (s *script) Choose(question string, n int) int {
+	s.chat = append(s.chat, "? "+question)
+	choice := s.choices[0]
+	s.choices = s.choices[1:]
+	return choice
+}
+
+func (s *script) Chat(name, message string) {
+	s.chat = append(s.chat, name+": "+message)
+}
+
+func (s *script) Debug(name, message string)      {}
+func (s *script) Info(message string)             { s.chat = append(s.chat, "INFO: "+message) }
+func (s *script) Error(message string, err error) { s.chat = append(s.chat, "ERROR: "+message) }
+func (s *script) Stream(string, bool) session.Stream {
+	panic("streaming isn't enabled")
+}
+
+// newTestEngine returns an engine for gpt-4 which uses s for its input and
+// output, and the fake provider it uses. GPT familiarises itself with the
+// commands when the engine starts, then gives each of the responses in turn.
+func newTestEngine(t *testing.T, s *script, responses ...string) (*Engine, *provider.Fake) {
+	t.Helper()
+	ui.SetOutput(io.Discard)
+
+	fake := provider.NewFake(append([]string{"/help", "I'm ready."}, responses...)...)
+	return New(config.New().WithOpenAIAPIModel("gpt-4"), fake, module.NewRegistry(), s, s), fake
+}
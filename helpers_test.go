@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// useTestClient makes GPTChat use gpt-4 with a fake provider, which it returns,
+// and stops it printing anything until the test has finished. GPT familiarises
+// itself with the commands when a session starts, then gives each of the
+// responses in turn.
+func useTestClient(t *testing.T, responses ...string) *provider.Fake {
+	t.Helper()
+	ui.SetOutput(io.Discard)
+
+	oldClient, oldCfg := client, cfg
+	t.Cleanup(func() {
+		client, cfg = oldClient, oldCfg
+	})
+
+	fake := provider.NewFake(append([]string{"/help", "I'm ready."}, responses...)...)
+	client, cfg = fake, config.New().WithOpenAIAPIModel("gpt-4")
+	return fake
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// interruptHandler handles Ctrl-C (SIGINT).
+//
+// If a request or command is running, the first interrupt cancels it and
+// returns to the prompt. Otherwise, or if a second interrupt arrives before
+// the operation has finished, gptchat quits.
+type interruptHandler struct {
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	interrupted bool
+
+	// quit is closed once gptchat should quit
+	quit     chan struct{}
+	quitting bool
+}
+
+var interrupts *interruptHandler
+
+func newInterruptHandler() *interruptHandler {
+	return &interruptHandler{quit: make(chan struct{})}
+}
+
+func handleInterrupts() *interruptHandler {
+	h := newInterruptHandler()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	go h.handle(signals)
+
+	return h
+}
+
+// handle handles the interrupts received from signals
+func (h *interruptHandler) handle(signals <-chan os.Signal) {
+	for range signals {
+		h.interrupt()
+	}
+}
+
+// start returns a context for an operation which is cancelled by the next
+// interrupt, and a func which must be called once the operation is finished
+func (h *interruptHandler) start() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	h.mu.Lock()
+	h.cancel = cancel
+	h.interrupted = false
+	h.mu.Unlock()
+
+	return ctx, func() {
+		h.mu.Lock()
+		h.cancel = nil
+		h.mu.Unlock()
+		cancel()
+	}
+}
+
+// done returns a channel which is closed once gptchat should quit
+func (h *interruptHandler) done() <-chan struct{} {
+	return h.quit
+}
+
+func (h *interruptHandler) interrupt() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cancel != nil && !h.interrupted {
+		h.interrupted = true
+		h.cancel()
+		return
+	}
+
+	if h.quitting {
+		// something is stuck and isn't letting gptchat quit
+		ui.Println()
+		os.Exit(1)
+	}
+	h.quitting = true
+	close(h.quit)
+}
+
+// readUntilQuit returns the result of read, or false if gptchat should
+// quit before read returns
+func readUntilQuit[T any](read func() T) (T, bool) {
+	if interrupts == nil {
+		return read(), true
+	}
+
+	result := make(chan T, 1)
+	go func() {
+		result <- read()
+	}()
+
+	select {
+	case r := <-result:
+		return r, true
+	case <-interrupts.done():
+		ui.Println()
+		var zero T
+		return zero, false
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func quitting(h *interruptHandler) bool {
+	select {
+	case <-h.done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestInterruptHandler(t *testing.T) {
+	h := newInterruptHandler()
+	signals := make(chan os.Signal)
+	go h.handle(signals)
+
+	// the first interrupt cancels the operation, and the second quits
+	ctx, done := h.start()
+	signals <- os.Interrupt
+	assert.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, time.Millisecond)
+	assert.False(t, quitting(h))
+
+	signals <- os.Interrupt
+	assert.Eventually(t, func() bool { return quitting(h) }, time.Second, time.Millisecond)
+	done()
+
+	// an interrupt at the prompt quits straight away
+	h, signals = newInterruptHandler(), make(chan os.Signal)
+	go h.handle(signals)
+	ctx, done = h.start()
+	done()
+	signals <- os.Interrupt
+	assert.Eventually(t, func() bool { return quitting(h) }, time.Second, time.Millisecond)
+	assert.Error(t, ctx.Err())
+
+	// each operation can be cancelled
+	h, signals = newInterruptHandler(), make(chan os.Signal)
+	go h.handle(signals)
+	for i := 0; i < 2; i++ {
+		ctx, done = h.start()
+		signals <- os.Interrupt
+		assert.Eventually(t, func() bool { return ctx.Err() != nil }, time.Second, time.Millisecond)
+		done()
+	}
+	assert.False(t, quitting(h))
+}
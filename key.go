@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/ian-kent/gptchat/secret"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// loadAPIKey returns the API key for the provider from OPENAI_API_KEY, the
+// key command or the keyring, in that order.
+//
+// If none of them have it and interactive is true, the user is asked for it
+// and can save it in the keyring so they aren't asked again.
+func loadAPIKey(providerName string, interactive bool) (string, error) {
+	if apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY")); apiKey != "" {
+		return apiKey, nil
+	}
+
+	if keyCommand := cfg.KeyCommand(); keyCommand != "" {
+		return secret.Command(context.Background(), keyCommand)
+	}
+
+	if cfg.IsKeyringEnabled() {
+		apiKey, err := secret.KeyringGet(providerName)
+		switch {
+		case err == nil:
+			return apiKey, nil
+		case errors.Is(err, secret.ErrNotFound), errors.Is(err, secret.ErrNoKeyring):
+		default:
+			ui.Warn(err.Error())
+		}
+	}
+
+	// OpenAI compatible servers don't usually need an API key
+	if providerName == "openai-compatible" {
+		return "", nil
+	}
+
+	if !interactive {
+		return "", errors.New("you haven't configured an OpenAI API key, set the OPENAI_API_KEY environment variable, use key_command, or save it in the keyring")
+	}
+
+	ui.Warn("You haven't configured an OpenAI API key")
+	ui.Println()
+	if !ui.PromptConfirm("Do you have an API key?") {
+		ui.Warn("You'll need an API key to use GPTChat")
+		ui.Println()
+		ui.Println("* You can get an API key at https://platform.openai.com/account/api-keys")
+		ui.Println("* You can get join the GPT-4 API waitlist at https://openai.com/waitlist/gpt-4-api")
+		os.Exit(1)
+	}
+
+	apiKey := ui.PromptSecret("Enter your API key:")
+	if apiKey == "" {
+		ui.Println("")
+		ui.Warn("You didn't enter an API key.")
+		os.Exit(1)
+	}
+
+	if cfg.IsKeyringEnabled() && secret.KeyringAvailable() && ui.PromptConfirm("Do you want to save the API key in your keyring?") {
+		if err := secret.KeyringSet(providerName, apiKey); err != nil {
+			ui.Warn(err.Error())
+		} else {
+			ui.Info("Your API key has been saved in your keyring")
+		}
+	}
+
+	return apiKey, nil
+}
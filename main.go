@@ -1,55 +1,100 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ian-kent/gptchat/config"
 	"github.com/ian-kent/gptchat/module"
 	"github.com/ian-kent/gptchat/module/memory"
 	"github.com/ian-kent/gptchat/module/plugin"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/secret"
+	"github.com/ian-kent/gptchat/session"
 	"github.com/ian-kent/gptchat/ui"
-	openai "github.com/sashabaranov/go-openai"
+	"github.com/ian-kent/gptchat/usage"
+	"github.com/ian-kent/gptchat/util"
+	"github.com/spf13/cobra"
 )
 
-var client *openai.Client
+var client provider.Provider
 var cfg = config.New()
 
-func init() {
-	openaiAPIKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
-	if openaiAPIKey == "" {
-		ui.Warn("You haven't configured an OpenAI API key")
-		fmt.Println()
-		if !ui.PromptConfirm("Do you have an API key?") {
-			ui.Warn("You'll need an API key to use GPTChat")
-			fmt.Println()
-			fmt.Println("* You can get an API key at https://platform.openai.com/account/api-keys")
-			fmt.Println("* You can get join the GPT-4 API waitlist at https://openai.com/waitlist/gpt-4-api")
-			os.Exit(1)
-		}
+// lifetimeUsage is the usage of every session, including previous ones
+var lifetimeUsage *usage.Tracker
+
+// setup loads the config, the provider and the modules.
+//
+// If interactive is false, the user can't be prompted for anything missing.
+func setup(interactive bool) error {
+	dataDir, err := config.DefaultDataDir()
+	if err != nil {
+		ui.Warn(fmt.Sprintf("error finding the data directory, the working directory will be used instead: %s", err))
+	} else {
+		cfg = cfg.WithDataDir(dataDir)
+	}
+
+	// the config file is applied first, then environment variables, then flags
+	if err := loadConfigFile(); err != nil {
+		return err
+	}
+	if dataDirEnv := strings.TrimSpace(os.Getenv("GPTCHAT_DATA_DIR")); dataDirEnv != "" {
+		cfg = cfg.WithDataDir(dataDirEnv)
+	}
 
-		openaiAPIKey = ui.PromptInput("Enter your API key:")
-		if openaiAPIKey == "" {
-			fmt.Println("")
-			ui.Warn("You didn't enter an API key.")
-			os.Exit(1)
+	if providerEnv := strings.ToLower(strings.TrimSpace(os.Getenv("GPTCHAT_PROVIDER"))); providerEnv != "" {
+		cfg = cfg.WithProvider(providerEnv)
+	}
+	if providerFlag != "" {
+		cfg = cfg.WithProvider(strings.ToLower(providerFlag))
+	}
+	providerName := cfg.Provider()
+
+	// a cassette can be replayed without using the API
+	replayPath := strings.TrimSpace(os.Getenv("GPTCHAT_REPLAY"))
+
+	if keyCommandEnv := strings.TrimSpace(os.Getenv("GPTCHAT_KEY_COMMAND")); keyCommandEnv != "" {
+		cfg = cfg.WithKeyCommand(keyCommandEnv)
+	}
+	keyringEnv := os.Getenv("GPTCHAT_KEYRING")
+	if keyringEnv != "" {
+		v, err := strconv.ParseBool(keyringEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_KEYRING: %s", err.Error()))
+		} else {
+			cfg = cfg.WithKeyring(v)
 		}
 	}
 
-	cfg = cfg.WithOpenAIAPIKey(openaiAPIKey)
+	// the API key is kept out of the config, since the config is given to every module
+	var openaiAPIKey string
+	if replayPath == "" {
+		openaiAPIKey, err = loadAPIKey(providerName, interactive)
+		if err != nil {
+			return err
+		}
+		secret.Register(openaiAPIKey)
+	}
 
-	openaiAPIModel := strings.TrimSpace(os.Getenv("OPENAI_API_MODEL"))
+	if openaiAPIModel := strings.TrimSpace(os.Getenv("OPENAI_API_MODEL")); openaiAPIModel != "" {
+		cfg = cfg.WithOpenAIAPIModel(openaiAPIModel)
+	}
+	if modelFlag != "" {
+		cfg = cfg.WithOpenAIAPIModel(modelFlag)
+	}
 
-	if openaiAPIModel == "" {
+	if cfg.OpenAIAPIModel() == "" {
 		ui.Warn("You haven't configured an OpenAI API model, defaulting to GPT4")
 
-		openaiAPIModel = openai.GPT4
+		cfg = cfg.WithOpenAIAPIModel(provider.DefaultModel)
 	}
 
-	cfg = cfg.WithOpenAIAPIModel(openaiAPIModel)
-
 	supervisorMode := os.Getenv("GPTCHAT_SUPERVISOR")
 	switch strings.ToLower(supervisorMode) {
 	case "disabled":
@@ -67,25 +112,504 @@ func init() {
 			cfg = cfg.WithDebugMode(v)
 		}
 	}
+	if flagChanged("debug") {
+		cfg = cfg.WithDebugMode(debugFlag)
+	}
+
+	if themeEnv := strings.TrimSpace(os.Getenv("GPTCHAT_THEME")); themeEnv != "" {
+		cfg = cfg.WithTheme(strings.ToLower(themeEnv))
+	}
+
+	streamingEnv := os.Getenv("GPTCHAT_STREAMING")
+	if streamingEnv != "" {
+		v, err := strconv.ParseBool(streamingEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_STREAMING: %s", err.Error()))
+		} else {
+			cfg = cfg.WithStreamingMode(v)
+		}
+	}
+
+	toolsEnv := os.Getenv("GPTCHAT_TOOLS")
+	if toolsEnv != "" {
+		v, err := strconv.ParseBool(toolsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_TOOLS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithToolsMode(v)
+		}
+	}
+
+	contextBudgetEnv := os.Getenv("GPTCHAT_CONTEXT_BUDGET")
+	if contextBudgetEnv != "" {
+		v, err := strconv.Atoi(contextBudgetEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_CONTEXT_BUDGET: %s", err.Error()))
+		} else {
+			cfg = cfg.WithContextBudget(v)
+		}
+	}
+
+	contextStrategy := strings.ToLower(strings.TrimSpace(os.Getenv("GPTCHAT_CONTEXT_STRATEGY")))
+	switch contextStrategy {
+	case "":
+	case config.ContextStrategyDrop, config.ContextStrategySummarise:
+		cfg = cfg.WithContextStrategy(contextStrategy)
+	default:
+		ui.Warn(fmt.Sprintf("unrecognised GPTCHAT_CONTEXT_STRATEGY: %s", contextStrategy))
+	}
+
+	retryMaxAttemptsEnv := os.Getenv("GPTCHAT_RETRY_MAX_ATTEMPTS")
+	if retryMaxAttemptsEnv != "" {
+		v, err := strconv.Atoi(retryMaxAttemptsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_RETRY_MAX_ATTEMPTS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithRetryMaxAttempts(v)
+		}
+	}
+
+	retryBaseDelayEnv := os.Getenv("GPTCHAT_RETRY_BASE_DELAY")
+	if retryBaseDelayEnv != "" {
+		v, err := time.ParseDuration(retryBaseDelayEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_RETRY_BASE_DELAY: %s", err.Error()))
+		} else {
+			cfg = cfg.WithRetryBaseDelay(v)
+		}
+	}
+
+	retryMaxDelayEnv := os.Getenv("GPTCHAT_RETRY_MAX_DELAY")
+	if retryMaxDelayEnv != "" {
+		v, err := time.ParseDuration(retryMaxDelayEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_RETRY_MAX_DELAY: %s", err.Error()))
+		} else {
+			cfg = cfg.WithRetryMaxDelay(v)
+		}
+	}
+
+	usageWarnEnv := os.Getenv("GPTCHAT_USAGE_WARN")
+	if usageWarnEnv != "" {
+		v, err := strconv.ParseFloat(usageWarnEnv, 64)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_USAGE_WARN: %s", err.Error()))
+		} else {
+			cfg = cfg.WithUsageWarnLimit(v)
+		}
+	}
+
+	usageLimitEnv := os.Getenv("GPTCHAT_USAGE_LIMIT")
+	if usageLimitEnv != "" {
+		v, err := strconv.ParseFloat(usageLimitEnv, 64)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_USAGE_LIMIT: %s", err.Error()))
+		} else {
+			cfg = cfg.WithUsageLimit(v)
+		}
+	}
+
+	maxAutonomousTurnsEnv := os.Getenv("GPTCHAT_MAX_AUTONOMOUS_TURNS")
+	if maxAutonomousTurnsEnv != "" {
+		v, err := strconv.Atoi(maxAutonomousTurnsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_MAX_AUTONOMOUS_TURNS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithMaxAutonomousTurns(v)
+		}
+	}
+
+	maxRepeatedCommandsEnv := os.Getenv("GPTCHAT_MAX_REPEATED_COMMANDS")
+	if maxRepeatedCommandsEnv != "" {
+		v, err := strconv.Atoi(maxRepeatedCommandsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_MAX_REPEATED_COMMANDS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithMaxRepeatedCommands(v)
+		}
+	}
+
+	intervalTurnsEnv := os.Getenv("GPTCHAT_INTERVAL_TURNS")
+	if intervalTurnsEnv != "" {
+		v, err := strconv.Atoi(intervalTurnsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_INTERVAL_TURNS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithIntervalPromptTurns(v)
+		}
+	}
+
+	intervalTimeEnv := os.Getenv("GPTCHAT_INTERVAL_TIME")
+	if intervalTimeEnv != "" {
+		v, err := time.ParseDuration(intervalTimeEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_INTERVAL_TIME: %s", err.Error()))
+		} else {
+			cfg = cfg.WithIntervalPromptTime(v)
+		}
+	}
+
+	concurrentCommandsEnv := os.Getenv("GPTCHAT_CONCURRENT_COMMANDS")
+	if concurrentCommandsEnv != "" {
+		v, err := strconv.Atoi(concurrentCommandsEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_CONCURRENT_COMMANDS: %s", err.Error()))
+		} else {
+			cfg = cfg.WithConcurrentCommands(v)
+		}
+	}
+
+	outputLimitEnv := os.Getenv("GPTCHAT_OUTPUT_LIMIT")
+	if outputLimitEnv != "" {
+		v, err := strconv.Atoi(outputLimitEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_OUTPUT_LIMIT: %s", err.Error()))
+		} else {
+			cfg = cfg.WithOutputLimit(v)
+		}
+	}
+
+	// module limits look like 'plugin=2000,memory=5000'
+	outputLimitsEnv := os.Getenv("GPTCHAT_OUTPUT_LIMITS")
+	for _, limit := range strings.Split(outputLimitsEnv, ",") {
+		if strings.TrimSpace(limit) == "" {
+			continue
+		}
+		parts := strings.SplitN(limit, "=", 2)
+		if len(parts) != 2 {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_OUTPUT_LIMITS: %s should be module=limit", limit))
+			continue
+		}
+		v, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_OUTPUT_LIMITS: %s", err.Error()))
+			continue
+		}
+		cfg = cfg.WithModuleOutputLimit(strings.TrimPrefix(strings.TrimSpace(parts[0]), "/"), v)
+	}
 
-	client = openai.NewClient(openaiAPIKey)
+	outputPagingEnv := os.Getenv("GPTCHAT_OUTPUT_PAGING")
+	if outputPagingEnv != "" {
+		v, err := strconv.ParseBool(outputPagingEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_OUTPUT_PAGING: %s", err.Error()))
+		} else {
+			cfg = cfg.WithOutputPaging(v)
+		}
+	}
+
+	candidatesEnv := os.Getenv("GPTCHAT_CANDIDATES")
+	if candidatesEnv != "" {
+		v, err := strconv.Atoi(candidatesEnv)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_CANDIDATES: %s", err.Error()))
+		} else {
+			cfg = cfg.WithCandidates(v)
+		}
+	}
+
+	moduleModelsEnv := os.Getenv("GPTCHAT_MODULE_MODELS")
+	for _, model := range strings.Split(moduleModelsEnv, ",") {
+		if strings.TrimSpace(model) == "" {
+			continue
+		}
+		parts := strings.SplitN(model, "=", 2)
+		if len(parts) != 2 {
+			ui.Warn(fmt.Sprintf("error parsing GPTCHAT_MODULE_MODELS: %s should be module=model", model))
+			continue
+		}
+		cfg = cfg.WithModuleModel(strings.TrimPrefix(strings.TrimSpace(parts[0]), "/"), strings.TrimSpace(parts[1]))
+	}
+
+	fallbackModelsEnv := os.Getenv("GPTCHAT_FALLBACK_MODELS")
+	if fallbackModelsEnv != "" {
+		var models []string
+		for _, model := range strings.Split(fallbackModelsEnv, ",") {
+			if model = strings.TrimSpace(model); model != "" {
+				models = append(models, model)
+			}
+		}
+		cfg = cfg.WithFallbackModels(models...)
+	}
+
+	// sampling parameters are set using GPTCHAT_TEMPERATURE, GPTCHAT_TOP_P and so on
+	for _, name := range config.SamplingParameters {
+		env := "GPTCHAT_" + strings.ToUpper(name)
+		if value := os.Getenv(env); value != "" {
+			v, err := cfg.WithSamplingParameter(name, value)
+			if err != nil {
+				ui.Warn(fmt.Sprintf("error parsing %s: %s", env, err.Error()))
+			} else {
+				cfg = v
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	ui.SetTheme(cfg.Theme())
+
+	if err := migrateData(cfg); err != nil {
+		ui.Warn(err.Error())
+	}
+	for _, dir := range []string{cfg.DataDir(), cfg.PluginSourcePath(), cfg.PluginCompiledPath()} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return fmt.Errorf("error creating directory: %w", err)
+		}
+	}
+	plugin.PluginSourcePath = cfg.PluginSourcePath()
+	plugin.PluginCompilePath = cfg.PluginCompiledPath()
+	session.SavePath = cfg.SessionsPath()
+
+	if replayPath != "" {
+		ui.Warn(fmt.Sprintf("Replaying responses from %s", replayPath))
+		cassette, err := provider.Replay(replayPath)
+		if err != nil {
+			return err
+		}
+		// dates in the conversation won't match the ones which were recorded
+		client = cassette.Ignore(util.DatePattern)
+	} else {
+		client, err = newProvider(providerName, openaiAPIKey)
+		if err != nil {
+			return err
+		}
+		if fallbackModels := cfg.FallbackModels(); len(fallbackModels) > 0 {
+			client, err = newFallback(client, fallbackModels, openaiAPIKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if recordPath := strings.TrimSpace(os.Getenv("GPTCHAT_RECORD")); recordPath != "" {
+		ui.Warn(fmt.Sprintf("Recording requests and responses to %s", recordPath))
+		client = provider.Record(client, recordPath)
+	}
+
+	lifetimeUsage, err = usage.LoadTracker(cfg.UsagePath())
+	if err != nil {
+		ui.Warn(fmt.Sprintf("error loading usage, usage from previous sessions won't be included: %s", err))
+		lifetimeUsage = usage.NewTracker(0, 0)
+	}
+	client = usage.NewProvider(client, lifetimeUsage)
 
 	module.Load(cfg, client, []module.Module{
 		&memory.Module{},
 		&plugin.Module{},
 	}...)
 
-	if err := module.LoadCompiledPlugins(); err != nil {
+	if err := module.LoadCompiledPlugins(cfg.PluginCompiledPath()); err != nil {
 		ui.Warn(fmt.Sprintf("error loading compiled plugins: %s", err))
 	}
+
+	return nil
 }
 
-func main() {
-	ui.Welcome(
-		`Welcome to the GPT client.`,
-		`You can talk directly to GPT, or you can use /commands to interact with the client.
+// configSource describes where the config file was loaded from, if there was one
+var configSource string
+
+// loadConfigFile applies the config file, if there is one, to cfg. The file is
+// config.yaml in the config directory unless another is chosen using --config
+// or GPTCHAT_CONFIG.
+func loadConfigFile() error {
+	path, chosen := configFlag, configFlag != ""
+	if path == "" {
+		path = strings.TrimSpace(os.Getenv("GPTCHAT_CONFIG"))
+		chosen = path != ""
+	}
+	if path == "" {
+		dir, err := config.DefaultConfigDir()
+		if err != nil {
+			ui.Warn(fmt.Sprintf("error finding the config directory: %s", err))
+			return nil
+		}
+		path = filepath.Join(dir, "config.yaml")
+	}
+
+	f, err := config.LoadFile(path)
+	if os.IsNotExist(err) && !chosen {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	profile := profileFlag
+	if profile == "" {
+		profile = strings.TrimSpace(os.Getenv("GPTCHAT_PROFILE"))
+	}
+	cfg, err = f.Apply(cfg, profile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	configSource = path
+	if profile == "" {
+		profile = f.Profile
+	}
+	if profile != "" {
+		configSource += fmt.Sprintf(" using the %s profile", profile)
+	}
+	return nil
+}
+
+var promptFlag string
+var stdinFlag bool
+var resumeFlag bool
+
+var configFlag string
+var profileFlag string
+var providerFlag string
+var modelFlag string
+var debugFlag bool
+
+// flagChanged returns true if a flag was set on the command line, so flags
+// only override the config when they've been used
+var flagChanged func(name string) bool
+
+var rootCmd = &cobra.Command{
+	Use:   "gptchat",
+	Short: "GPTChat is a client which gives GPT-4 some unique tools to be a better AI",
+	Long: `GPTChat is a client which gives GPT-4 some unique tools to be a better AI.
+
+Run it without any arguments to start a conversation.
+
+To use it from scripts, give it a prompt with --prompt or pipe one in
+using stdin, and use --stdin to add what's piped in to the --prompt.
+GPTChat will execute any commands GPT uses, and print GPT's final
+response to stdout.`,
+	Args:          cobra.NoArgs,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prompt, err := readPrompt(promptFlag, stdinFlag, os.Stdin)
+		if err != nil {
+			return err
+		}
+		if prompt != "" {
+			return runNonInteractive(prompt)
+		}
+
+		if err := setup(true); err != nil {
+			return err
+		}
+
+		ui.Welcome(
+			`Welcome to the GPT client.`,
+			`You can talk directly to GPT, or you can use /commands to interact with the client.
 
 Use /help to see a list of available commands.`)
 
-	chatLoop(cfg)
+		interrupts = handleInterrupts()
+		e := newTerminalEngine()
+		chat := e.Session()
+		if resumeFlag {
+			name, err := session.Last()
+			if err != nil {
+				return fmt.Errorf("error resuming the last conversation: %w", err)
+			}
+			if err := chat.Load(name); err != nil {
+				return fmt.Errorf("error resuming the last conversation: %w", err)
+			}
+			printResumed(chat)
+		}
+
+		return e.Run()
+	},
+}
+
+var serveAddr string
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Start a HTTP server which other front ends can use to talk to GPT",
+	Long: `Start a HTTP server which other front ends can use to talk to GPT.
+
+Sessions are created and messages are sent using the REST API, and
+responses and commands are streamed using Server-Sent Events.
+
+In supervised mode, plugins are approved using the API.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := setup(false); err != nil {
+			return err
+		}
+
+		// responses are streamed to clients as events
+		cfg = cfg.WithStreamingMode(true)
+
+		ui.Info(fmt.Sprintf("Listening on http://%s", serveAddr))
+		return http.ListenAndServe(serveAddr, newServer())
+	},
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFlag, "config", "", "the config file to use, instead of config.yaml in the config directory")
+	rootCmd.PersistentFlags().StringVar(&profileFlag, "profile", "", "the profile to use from the config file")
+	rootCmd.PersistentFlags().StringVar(&providerFlag, "provider", "", "the provider to use, overriding the config file and GPTCHAT_PROVIDER")
+	rootCmd.PersistentFlags().StringVarP(&modelFlag, "model", "m", "", "the model to use, overriding the config file and OPENAI_API_MODEL")
+	rootCmd.PersistentFlags().BoolVar(&debugFlag, "debug", false, "enable debug mode, overriding the config file and GPTCHAT_DEBUG")
+	flagChanged = rootCmd.PersistentFlags().Changed
+	rootCmd.Flags().StringVarP(&promptFlag, "prompt", "p", "", "send a prompt to GPT and print the response, instead of starting a conversation")
+	rootCmd.Flags().BoolVar(&stdinFlag, "stdin", false, "add what's piped in using stdin to the --prompt")
+	rootCmd.Flags().BoolVarP(&resumeFlag, "resume", "r", false, "resume the most recently saved conversation")
+
+	serveCmd.Flags().StringVar(&serveAddr, "addr", "localhost:8080", "the address to listen on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+func main() {
+	if err := rootCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+// newFallback returns a provider which falls back to each of models in turn. A model
+// can use a different provider by starting with its name, e.g. openai-compatible:llama3,
+// otherwise it uses p.
+func newFallback(p provider.Provider, models []string, apiKey string) (provider.Provider, error) {
+	var entries []provider.FallbackEntry
+	for _, model := range models {
+		entry := provider.FallbackEntry{Model: model}
+		for _, name := range config.Providers {
+			if strings.HasPrefix(model, name+":") {
+				fallback, err := newProvider(name, apiKey)
+				if err != nil {
+					return nil, fmt.Errorf("error creating fallback provider for %s: %s", model, err)
+				}
+				entry = provider.FallbackEntry{Model: strings.TrimPrefix(model, name+":"), Provider: fallback}
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return provider.NewFallback(p, entries...), nil
+}
+
+func newProvider(name, apiKey string) (provider.Provider, error) {
+	switch name {
+	case "", "openai":
+		return provider.NewOpenAI(apiKey), nil
+	case "azure":
+		endpoint := strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT"))
+		if endpoint == "" {
+			return nil, errors.New("AZURE_OPENAI_ENDPOINT is required for the azure provider")
+		}
+		deployment := strings.TrimSpace(os.Getenv("AZURE_OPENAI_DEPLOYMENT"))
+		return provider.NewAzure(apiKey, endpoint, deployment), nil
+	case "openai-compatible":
+		baseURL := strings.TrimSpace(os.Getenv("OPENAI_BASE_URL"))
+		if baseURL == "" {
+			return nil, errors.New("OPENAI_BASE_URL is required for the openai-compatible provider")
+		}
+		return provider.NewOpenAICompatible(apiKey, baseURL), nil
+	default:
+		return nil, fmt.Errorf("unrecognised provider: %s", name)
+	}
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// migratedFile is created in the data directory once data has been migrated to it
+const migratedFile = ".migrated"
+
+// migration is data which older versions of GPTChat kept in the working directory
+type migration struct {
+	name string
+	from string
+	to   string
+}
+
+// migrateData copies memories, plugin source, saved conversations and usage
+// from the working directory, where older versions of GPTChat kept them, to
+// the data directory. Nothing which is already in the data directory is
+// overwritten.
+//
+// Once something has been migrated, it doesn't happen again for the same data
+// directory unless migratedFile is deleted. Until then, it's tried each time
+// GPTChat starts, since it might not be started from the old directory.
+//
+// Compiled plugins aren't migrated, since plugins compiled by older versions
+// of GPTChat don't implement the Plugin interface any more.
+func migrateData(cfg config.Config) error {
+	dataDir := cfg.DataDir()
+	if dataDir == "" {
+		return nil
+	}
+	marker := filepath.Join(dataDir, migratedFile)
+	if _, err := os.Stat(marker); err == nil {
+		return nil
+	}
+
+	migrations := []migration{
+		{name: "memories", from: "memories.json", to: cfg.MemoryPath()},
+		{name: "plugin source", from: filepath.Join("module", "plugin", "source"), to: cfg.PluginSourcePath()},
+		{name: "saved conversations", from: "sessions", to: cfg.SessionsPath()},
+		{name: "usage", from: "usage.json", to: cfg.UsagePath()},
+	}
+	var migrated bool
+	for _, m := range migrations {
+		copied, err := m.run()
+		if err != nil {
+			return fmt.Errorf("error migrating %s from %s: %s", m.name, m.from, err)
+		}
+		if copied {
+			ui.Info(fmt.Sprintf("Your %s have been copied from %s to %s", m.name, m.from, m.to))
+			migrated = true
+		}
+	}
+	if !migrated {
+		return nil
+	}
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(marker, nil, 0600); err != nil {
+		return err
+	}
+	ui.Info(fmt.Sprintf("To copy your data from another directory, delete %s and start GPTChat from that directory", marker))
+	return nil
+}
+
+// run copies the data, and returns true if anything was copied
+func (m migration) run() (bool, error) {
+	info, err := os.Stat(m.from)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// the data might already be where it's meant to be
+	from, err := filepath.Abs(m.from)
+	if err != nil {
+		return false, err
+	}
+	to, err := filepath.Abs(m.to)
+	if err != nil {
+		return false, err
+	}
+	if from == to {
+		return false, nil
+	}
+
+	if !info.IsDir() {
+		return copyFile(from, to)
+	}
+	return copyDir(from, to)
+}
+
+// copyDir copies everything in from which isn't already in to, apart from
+// the README files which are part of the repository
+func copyDir(from, to string) (bool, error) {
+	var copied bool
+	err := filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || rel == "README.md" {
+			return nil
+		}
+
+		ok, err := copyFile(path, filepath.Join(to, rel))
+		copied = copied || ok
+		return err
+	})
+	return copied, err
+}
+
+// copyFile copies from to to, unless to already exists
+func copyFile(from, to string) (bool, error) {
+	if _, err := os.Stat(to); err == nil {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return false, err
+	}
+
+	src, err := os.Open(from)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return false, err
+	}
+	dst, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return false, err
+	}
+	return true, dst.Close()
+}
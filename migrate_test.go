@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/testutil"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateData(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	old := t.TempDir()
+	testutil.Chdir(t, old)
+
+	write := func(path, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+	read := func(path string) string {
+		b, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	write("memories.json", "[]")
+	write(filepath.Join("module", "plugin", "source", "README.md"), "readme")
+	write(filepath.Join("module", "plugin", "source", "add", "plugin.go"), "package main")
+	write(filepath.Join("module", "plugin", "compiled", "add.so"), "old plugin")
+	write(filepath.Join("sessions", "chat.json"), "{}")
+
+	dataDir := filepath.Join(t.TempDir(), "gptchat")
+	cfg := config.New().WithDataDir(dataDir)
+
+	// nothing is migrated from a directory without any data, so it can
+	// still be migrated when GPTChat is started from the old directory
+	testutil.Chdir(t, t.TempDir())
+	require.NoError(t, migrateData(cfg))
+	assert.NoFileExists(t, filepath.Join(dataDir, migratedFile))
+	testutil.Chdir(t, old)
+
+	// anything already in the data directory is kept
+	write(filepath.Join(dataDir, "sessions", "chat.json"), "newer")
+
+	require.NoError(t, migrateData(cfg))
+	assert.Equal(t, "[]", read(cfg.MemoryPath()))
+	assert.Equal(t, "package main", read(filepath.Join(cfg.PluginSourcePath(), "add", "plugin.go")))
+	assert.NoFileExists(t, filepath.Join(cfg.PluginSourcePath(), "README.md"))
+	assert.NoFileExists(t, filepath.Join(cfg.PluginCompiledPath(), "add.so"))
+	assert.Equal(t, "newer", read(filepath.Join(cfg.SessionsPath(), "chat.json")))
+	assert.NoFileExists(t, cfg.UsagePath())
+
+	// the migration only happens once
+	write("usage.json", "{}")
+	require.NoError(t, migrateData(cfg))
+	assert.NoFileExists(t, cfg.UsagePath())
+}
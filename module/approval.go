@@ -0,0 +1,81 @@
+package module
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// ApprovalRequest describes an action which needs the user's approval
+// before it can go ahead, for example compiling a GPT written plugin
+type ApprovalRequest struct {
+	// Warning is a short description of why approval is needed
+	Warning string
+	// Details explains what will happen if the action is approved
+	Details string
+	// Content is anything the user should review, for example source code
+	Content string
+}
+
+// Approver asks the user to approve an action.
+//
+// Approve returns nil if the action is approved, otherwise the error explains why it wasn't.
+type Approver interface {
+	Approve(ctx context.Context, req ApprovalRequest) error
+}
+
+// ErrNotApproved is returned when the user doesn't approve an action
+var ErrNotApproved = errors.New("the user did not approve this action")
+
+// ErrNoApprover is returned by DenyApprover, since nobody is available to approve the action
+var ErrNoApprover = errors.New("approval isn't available when running non-interactively")
+
+type approverKey struct{}
+
+// WithApprover returns a context which uses approver to approve actions
+func WithApprover(ctx context.Context, approver Approver) context.Context {
+	return context.WithValue(ctx, approverKey{}, approver)
+}
+
+// Approve asks the user to approve an action using the Approver from ctx,
+// or using the terminal if ctx doesn't have one
+func Approve(ctx context.Context, req ApprovalRequest) error {
+	approver, ok := ctx.Value(approverKey{}).(Approver)
+	if !ok {
+		approver = TerminalApprover{}
+	}
+	return approver.Approve(ctx, req)
+}
+
+// TerminalApprover asks the user to approve actions at the terminal
+type TerminalApprover struct{}
+
+func (TerminalApprover) Approve(ctx context.Context, req ApprovalRequest) error {
+	ui.Println("============================================================")
+	ui.Println()
+	ui.Warn(req.Warning)
+	ui.Println()
+	ui.Println(req.Details)
+	ui.Println()
+	confirmation := ui.PromptInput("Enter 'confirm' to confirm, anything else will block:")
+	ui.Println()
+	if confirmation != "confirm" {
+		ui.Println("============================================================")
+		// whatever the user entered is passed back to GPT as the reason
+		if confirmation == "" {
+			return ErrNotApproved
+		}
+		return errors.New(confirmation)
+	}
+	ui.Println("============================================================")
+	ui.Println()
+	return nil
+}
+
+// DenyApprover refuses every action, for when there's nobody to ask
+type DenyApprover struct{}
+
+func (DenyApprover) Approve(context.Context, ApprovalRequest) error {
+	return ErrNoApprover
+}
@@ -1,12 +1,14 @@
 package memory
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
 	"github.com/ian-kent/gptchat/util"
-	openai "github.com/sashabaranov/go-openai"
 )
 
 type memory struct {
@@ -15,8 +17,11 @@ type memory struct {
 }
 
 type Module struct {
-	cfg      config.Config
-	client   *openai.Client
+	cfg    config.Config
+	client provider.Provider
+
+	// mu protects memories, since several conversations can use the module at once
+	mu       sync.Mutex
 	memories []memory
 }
 
@@ -24,7 +29,7 @@ func (m *Module) ID() string {
 	return "memory"
 }
 
-func (m *Module) Load(cfg config.Config, client *openai.Client) error {
+func (m *Module) Load(cfg config.Config, client provider.Provider) error {
 	m.cfg = cfg
 	m.client = client
 	return m.loadFromFile()
@@ -34,12 +39,12 @@ func (m *Module) UpdateConfig(cfg config.Config) {
 	m.cfg = cfg
 }
 
-func (m *Module) Execute(args, body string) (string, error) {
+func (m *Module) Execute(ctx context.Context, args, body string) (string, error) {
 	switch args {
 	case "store":
 		return m.Store(body)
 	case "recall":
-		return m.Recall(body)
+		return m.Recall(ctx, body)
 	default:
 		return "", errors.New(fmt.Sprintf("command not implemented: /memory %s", args))
 	}
@@ -49,6 +54,11 @@ func (m *Module) Prompt() string {
 	return memoryPrompt
 }
 
+// IntervalPrompt reminds GPT about its memory, since it tends to forget it has one
+func (m *Module) IntervalPrompt() string {
+	return `Remember that you have a long term memory. Use '/memory store' to remember anything useful I tell you, and '/memory recall' when I ask about something you might already know.`
+}
+
 const memoryPrompt = `You also have a working long term memory.
 
 You can remember something using the '/memory store' command, or you can recall it using the '/memory recall' command.
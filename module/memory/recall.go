@@ -2,50 +2,57 @@ package memory
 
 import (
 	"context"
-	"encoding/json"
 
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/retry"
 	"github.com/ian-kent/gptchat/util"
-	"github.com/sashabaranov/go-openai"
 )
 
-func (m *Module) Recall(input string) (string, error) {
-	b, err := json.Marshal(m.memories)
+func (m *Module) Recall(ctx context.Context, input string) (string, error) {
+	b, err := m.marshalMemories()
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := m.client.CreateChatCompletion(
-		context.Background(),
-		openai.ChatCompletionRequest{
-			Model: m.cfg.OpenAIAPIModel(),
-			Messages: []openai.ChatCompletionMessage{
-				{
-					Role: openai.ChatMessageRoleSystem,
-					Content: `You are a helpful assistant.
+	cfg := module.ConfigFromContext(ctx, m.cfg)
+	req := provider.ChatRequest{
+		Model:    cfg.ModuleModel("memory"),
+		Sampling: cfg.Sampling(),
+		Messages: []provider.Message{
+			{
+				Role: provider.RoleSystem,
+				Content: `You are a helpful assistant.
 
 I'll give you a list of existing memories, and a prompt which asks you to identify the memory I'm looking for.
 
 You should review the listed memories and suggest which memories might match the request.`,
-				},
-				{
-					Role: openai.ChatMessageRoleSystem,
-					Content: `Here are your memories in JSON format:
+			},
+			{
+				Role: provider.RoleSystem,
+				Content: `Here are your memories in JSON format:
 
 ` + util.TripleQuote + `
 ` + string(b) + `
 ` + util.TripleQuote,
-				},
-				{
-					Role: openai.ChatMessageRoleSystem,
-					Content: `Help me find any memories which may match this request:
+			},
+			{
+				Role: provider.RoleSystem,
+				Content: `Help me find any memories which may match this request:
 
 ` + util.TripleQuote + `
 ` + input + `
 ` + util.TripleQuote,
-				},
 			},
 		},
-	)
+	}
+
+	var resp provider.ChatResponse
+	err = retry.FromConfig(cfg).Do(ctx, func() error {
+		var err error
+		resp, err = m.client.CreateChatCompletion(ctx, req)
+		return err
+	})
 	if err != nil {
 		return "", err
 	}
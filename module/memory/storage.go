@@ -7,12 +7,12 @@ import (
 )
 
 func (m *Module) loadFromFile() error {
-	_, err := os.Stat("memories.json")
+	_, err := os.Stat(m.cfg.MemoryPath())
 	if os.IsNotExist(err) {
 		return nil
 	}
 
-	b, err := ioutil.ReadFile("memories.json")
+	b, err := ioutil.ReadFile(m.cfg.MemoryPath())
 	if err != nil {
 		return err
 	}
@@ -31,7 +31,7 @@ func (m *Module) writeToFile() error {
 		return err
 	}
 
-	err = ioutil.WriteFile("memories.json", b, 0660)
+	err = ioutil.WriteFile(m.cfg.MemoryPath(), b, 0660)
 	if err != nil {
 		return err
 	}
@@ -39,6 +39,16 @@ func (m *Module) writeToFile() error {
 }
 
 func (m *Module) appendMemory(mem memory) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.memories = append(m.memories, mem)
 	return m.writeToFile()
 }
+
+func (m *Module) marshalMemories() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return json.Marshal(m.memories)
+}
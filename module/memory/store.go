@@ -7,7 +7,7 @@ import (
 
 func (m *Module) Store(input string) (string, error) {
 	err := m.appendMemory(memory{
-		DateStored: time.Now().Format("02 January 2006, 03:04pm"),
+		DateStored: time.Now().Format(util.DateFormat),
 		Memory:     input,
 	})
 	if err != nil {
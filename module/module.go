@@ -1,20 +1,23 @@
 package module
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
 	"github.com/ian-kent/gptchat/ui"
-	openai "github.com/sashabaranov/go-openai"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type Module interface {
-	Load(config.Config, *openai.Client) error
+	Load(config.Config, provider.Provider) error
 	UpdateConfig(config.Config)
 	ID() string
 	Prompt() string
-	Execute(args, body string) (string, error)
+	Execute(ctx context.Context, args, body string) (string, error)
 }
 
 // IntervalPrompt allows a module to inject a prompt into the interval prompt
@@ -22,9 +25,70 @@ type IntervalPrompt interface {
 	IntervalPrompt() string
 }
 
-var loadedModules = make(map[string]Module)
+// Serial allows a module to say which of its commands must be executed on their
+// own, rather than at the same time as other commands from the same response
+type Serial interface {
+	Serial(args string) bool
+}
+
+// Registry holds the loaded modules, it's safe for concurrent use
+type Registry struct {
+	mu      sync.RWMutex
+	modules map[string]Module
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		modules: make(map[string]Module),
+	}
+}
+
+// defaultRegistry is used by the package level functions
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry used by the package level functions
+func Default() *Registry {
+	return defaultRegistry
+}
+
+type registryKey struct{}
+
+// WithRegistry returns a context which modules can use to find the registry executing them
+func WithRegistry(ctx context.Context, registry *Registry) context.Context {
+	return context.WithValue(ctx, registryKey{}, registry)
+}
+
+// RegistryFromContext returns the registry from ctx, or the default registry if ctx doesn't have one
+func RegistryFromContext(ctx context.Context) *Registry {
+	if registry, ok := ctx.Value(registryKey{}).(*Registry); ok {
+		return registry
+	}
+	return defaultRegistry
+}
 
-func Load(cfg config.Config, client *openai.Client, modules ...Module) error {
+type configKey struct{}
+
+// WithConfig returns a context which gives modules the config of the conversation executing them
+func WithConfig(ctx context.Context, cfg config.Config) context.Context {
+	return context.WithValue(ctx, configKey{}, cfg)
+}
+
+// ConfigFromContext returns the config from ctx, or cfg if ctx doesn't have one.
+//
+// Modules should prefer this to the config they were loaded with, since
+// each conversation can change its own config.
+func ConfigFromContext(ctx context.Context, cfg config.Config) config.Config {
+	if c, ok := ctx.Value(configKey{}).(config.Config); ok {
+		return c
+	}
+	return cfg
+}
+
+func Load(cfg config.Config, client provider.Provider, modules ...Module) error {
+	return defaultRegistry.Load(cfg, client, modules...)
+}
+
+func (r *Registry) Load(cfg config.Config, client provider.Provider, modules ...Module) error {
 	for _, module := range modules {
 		if err := module.Load(cfg, client); err != nil {
 			ui.Warn(fmt.Sprintf("failed to load module %s: %s", module.ID(), err))
@@ -33,13 +97,19 @@ func Load(cfg config.Config, client *openai.Client, modules ...Module) error {
 		if cfg.IsDebugMode() {
 			ui.Info(fmt.Sprintf("loaded module %s", module.ID()))
 		}
-		loadedModules[module.ID()] = module
+		r.mu.Lock()
+		r.modules[module.ID()] = module
+		r.mu.Unlock()
 	}
 	return nil
 }
 
 func UpdateConfig(cfg config.Config) {
-	for _, module := range loadedModules {
+	defaultRegistry.UpdateConfig(cfg)
+}
+
+func (r *Registry) UpdateConfig(cfg config.Config) {
+	for _, module := range r.Loaded() {
 		_, ok := module.(pluginLoader)
 		if ok {
 			// GPT written plugins shouldn't have config, nothing to do
@@ -51,16 +121,67 @@ func UpdateConfig(cfg config.Config) {
 }
 
 func IsLoaded(id string) bool {
-	_, ok := loadedModules[id]
+	return defaultRegistry.IsLoaded(id)
+}
+
+func (r *Registry) IsLoaded(id string) bool {
+	_, ok := r.get(id)
 	return ok
 }
 
+func (r *Registry) get(id string) (Module, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	module, ok := r.modules[id]
+	return module, ok
+}
+
+// Loaded returns the loaded modules, sorted by ID
+func Loaded() []Module {
+	return defaultRegistry.Loaded()
+}
+
+func (r *Registry) Loaded() []Module {
+	r.mu.RLock()
+	var modules []Module
+	for _, module := range r.modules {
+		modules = append(modules, module)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].ID() < modules[j].ID()
+	})
+	return modules
+}
+
+func IntervalPrompts() []string {
+	return defaultRegistry.IntervalPrompts()
+}
+
+// IntervalPrompts returns the interval prompts of the loaded modules which have one
+func (r *Registry) IntervalPrompts() []string {
+	var prompts []string
+	for _, mod := range r.Loaded() {
+		if m, ok := mod.(IntervalPrompt); ok {
+			if prompt := strings.TrimSpace(m.IntervalPrompt()); prompt != "" {
+				prompts = append(prompts, prompt)
+			}
+		}
+	}
+	return prompts
+}
+
 func LoadPlugin(m Module) error {
-	// a plugin doesn't have access to the openai client so it's safe to pass in nil here
+	return defaultRegistry.LoadPlugin(m)
+}
+
+func (r *Registry) LoadPlugin(m Module) error {
+	// a plugin doesn't have access to the provider so it's safe to pass in nil here
 	//
 	// we also don't pass in the config since it may contain sensitive information that
 	// we don't want GPT to have access to
-	return Load(config.Config{}, nil, m)
+	return r.Load(config.Config{}, nil, m)
 }
 
 type CommandResult struct {
@@ -69,8 +190,12 @@ type CommandResult struct {
 }
 
 func HelpCommand() (bool, *CommandResult) {
+	return defaultRegistry.HelpCommand()
+}
+
+func (r *Registry) HelpCommand() (bool, *CommandResult) {
 	result := "Here are the commands you have available:\n\n"
-	for _, mod := range loadedModules {
+	for _, mod := range r.Loaded() {
 		result += fmt.Sprintf("    * /%s\n", mod.ID())
 	}
 	result += `
@@ -83,13 +208,29 @@ Calling a command without any additional arguments will explain it's usage. You
 	}
 }
 
-func ExecuteCommand(command, args, body string) (bool, *CommandResult) {
+func ExecuteCommand(ctx context.Context, command, args, body string) (bool, *CommandResult) {
+	return defaultRegistry.ExecuteCommand(ctx, command, args, body)
+}
+
+// IsSerial returns true if a command must be executed on its own
+func (r *Registry) IsSerial(command, args string) bool {
+	mod, ok := r.get(strings.TrimPrefix(command, "/"))
+	if !ok {
+		return false
+	}
+	if m, ok := mod.(Serial); ok {
+		return m.Serial(args)
+	}
+	return false
+}
+
+func (r *Registry) ExecuteCommand(ctx context.Context, command, args, body string) (bool, *CommandResult) {
 	if command == "/help" {
-		return HelpCommand()
+		return r.HelpCommand()
 	}
 
 	cmd := strings.TrimPrefix(command, "/")
-	mod, ok := loadedModules[cmd]
+	mod, ok := r.get(cmd)
 	if !ok {
 		return true, &CommandResult{
 			Error: errors.New(fmt.Sprintf("Unrecognised command: %s", command)),
@@ -102,7 +243,7 @@ func ExecuteCommand(command, args, body string) (bool, *CommandResult) {
 		}
 	}
 
-	res, err := mod.Execute(args, body)
+	res, err := mod.Execute(WithRegistry(ctx, r), args, body)
 	if err != nil {
 		return true, &CommandResult{
 			Error: err,
@@ -0,0 +1,49 @@
+package module
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type namedModule struct {
+	echoModule
+	id string
+}
+
+func (m namedModule) ID() string { return m.id }
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	registry := NewRegistry()
+	registry.Load(config.New(), nil, echoModule{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			registry.LoadPlugin(namedModule{id: fmt.Sprintf("plugin-%d", i)})
+		}(i)
+		go func() {
+			defer wg.Done()
+			ok, result := registry.ExecuteCommand(context.Background(), "/echo", "args", "")
+			assert.True(t, ok)
+			assert.Equal(t, "args|", result.Prompt)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, registry.Loaded(), 11)
+	assert.Equal(t, "echo", registry.Loaded()[0].ID())
+}
+
+func TestRegistryFromContext(t *testing.T) {
+	assert.Equal(t, Default(), RegistryFromContext(context.Background()))
+
+	registry := NewRegistry()
+	assert.Equal(t, registry, RegistryFromContext(WithRegistry(context.Background(), registry)))
+}
@@ -1,13 +1,15 @@
 package module
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
 	"github.com/ian-kent/gptchat/ui"
-	"github.com/sashabaranov/go-openai"
 	"os"
+	"path/filepath"
 	"plugin"
 	"strings"
 )
@@ -15,14 +17,14 @@ import (
 type Plugin interface {
 	ID() string
 	Example() string
-	Execute(map[string]any) (map[string]any, error)
+	Execute(context.Context, map[string]any) (map[string]any, error)
 }
 
 type pluginLoader struct {
 	plugin Plugin
 }
 
-func (p pluginLoader) Load(config.Config, *openai.Client) error {
+func (p pluginLoader) Load(config.Config, provider.Provider) error {
 	return nil
 }
 func (p pluginLoader) UpdateConfig(config.Config) {}
@@ -32,7 +34,14 @@ func (p pluginLoader) ID() string {
 func (p pluginLoader) Prompt() string {
 	return p.plugin.Example()
 }
-func (p pluginLoader) Execute(args, body string) (string, error) {
+func (p pluginLoader) IntervalPrompt() string {
+	// plugins can have an interval prompt too
+	if i, ok := p.plugin.(IntervalPrompt); ok {
+		return i.IntervalPrompt()
+	}
+	return ""
+}
+func (p pluginLoader) Execute(ctx context.Context, args, body string) (string, error) {
 	input := make(map[string]any)
 	if body != "" {
 		err := json.Unmarshal([]byte(body), &input)
@@ -41,9 +50,27 @@ func (p pluginLoader) Execute(args, body string) (string, error) {
 		}
 	}
 
-	output, err := p.plugin.Execute(input)
-	if err != nil {
-		return "", fmt.Errorf("error executing plugin: %s", err)
+	// plugins are written by GPT and might not respect the context, so we
+	// run them in a goroutine to make sure they can still be cancelled
+	type result struct {
+		output map[string]any
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := p.plugin.Execute(ctx, input)
+		done <- result{output, err}
+	}()
+
+	var output map[string]any
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case r := <-done:
+		if r.err != nil {
+			return "", fmt.Errorf("error executing plugin: %s", r.err)
+		}
+		output = r.output
 	}
 
 	b, err := json.Marshal(output)
@@ -58,8 +85,12 @@ func GetModuleForPlugin(p Plugin) Module {
 	return pluginLoader{p}
 }
 
-func LoadCompiledPlugins() error {
-	pluginPath := "./module/plugin/compiled/"
+// LoadCompiledPlugins loads the compiled plugins in pluginPath
+func LoadCompiledPlugins(pluginPath string) error {
+	return defaultRegistry.LoadCompiledPlugins(pluginPath)
+}
+
+func (r *Registry) LoadCompiledPlugins(pluginPath string) error {
 	entries, err := os.ReadDir(pluginPath)
 	if err != nil {
 		return fmt.Errorf("error loading compiled plugins: %s", err)
@@ -70,19 +101,19 @@ func LoadCompiledPlugins() error {
 			continue
 		}
 
-		loadedPlugin, err := OpenPlugin(pluginPath + entry.Name())
+		loadedPlugin, err := OpenPlugin(filepath.Join(pluginPath, entry.Name()))
 		if err != nil {
 			ui.Warn(fmt.Sprintf("error opening plugin: %s", err))
 			continue
 		}
 
 		pluginID := loadedPlugin.ID()
-		if IsLoaded(pluginID) {
+		if r.IsLoaded(pluginID) {
 			ui.Warn(fmt.Sprintf("plugin with this ID is already loaded: %s", err))
 			continue
 		}
 
-		err = LoadPlugin(GetModuleForPlugin(loadedPlugin))
+		err = r.LoadPlugin(GetModuleForPlugin(loadedPlugin))
 		if err != nil {
 			ui.Warn(fmt.Sprintf("error loading plugin: %s", err))
 			continue
@@ -1,22 +1,21 @@
 package plugin
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/ian-kent/gptchat/config"
 	"github.com/ian-kent/gptchat/module"
-	"github.com/ian-kent/gptchat/ui"
+	"github.com/ian-kent/gptchat/provider"
 	"github.com/ian-kent/gptchat/util"
-	openai "github.com/sashabaranov/go-openai"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
 )
 
+// the plugin paths are set from the config when GPTChat starts
 var (
-	// TODO make this configurable
 	PluginSourcePath  = "./module/plugin/source"
 	PluginCompilePath = "./module/plugin/compiled"
 )
@@ -46,10 +45,10 @@ func CheckPaths() error {
 
 type Module struct {
 	cfg    config.Config
-	client *openai.Client
+	client provider.Provider
 }
 
-func (m *Module) Load(cfg config.Config, client *openai.Client) error {
+func (m *Module) Load(cfg config.Config, client provider.Provider) error {
 	m.cfg = cfg
 	m.client = client
 
@@ -72,7 +71,13 @@ func (m *Module) ID() string {
 	return "plugin"
 }
 
-func (m *Module) Execute(args, body string) (string, error) {
+// Serial makes sure plugins are created one at a time, since creating a
+// plugin can ask the user for approval and changes the loaded modules
+func (m *Module) Serial(args string) bool {
+	return strings.HasPrefix(args, "create")
+}
+
+func (m *Module) Execute(ctx context.Context, args, body string) (string, error) {
 	parts := strings.SplitN(args, " ", 2)
 	cmd := parts[0]
 	if len(parts) > 1 {
@@ -81,13 +86,13 @@ func (m *Module) Execute(args, body string) (string, error) {
 
 	switch cmd {
 	case "create":
-		return m.createPlugin(args, body)
+		return m.createPlugin(ctx, args, body)
 	default:
 		return "", errors.New(fmt.Sprintf("%s not implemented", args))
 	}
 }
 
-func (m *Module) createPlugin(id, body string) (string, error) {
+func (m *Module) createPlugin(ctx context.Context, id, body string) (string, error) {
 	body = strings.TrimSpace(body)
 	if len(body) == 0 {
 		return "", errors.New("plugin source not found")
@@ -102,7 +107,8 @@ func (m *Module) createPlugin(id, body string) (string, error) {
 		return "", errors.New("plugin id is invalid")
 	}
 
-	if module.IsLoaded(id) {
+	registry := module.RegistryFromContext(ctx)
+	if registry.IsLoaded(id) {
 		return "", errors.New("a plugin with this id already exists")
 	}
 
@@ -132,33 +138,26 @@ func (m *Module) createPlugin(id, body string) (string, error) {
 		return "", fmt.Errorf("error writing source file: %s", err)
 	}
 
-	if m.cfg.IsSupervisedMode() {
-		fmt.Println("============================================================")
-		fmt.Println()
-		ui.Warn("⚠️ GPT written plugins are untrusted code from the internet")
-		fmt.Println()
-		fmt.Println("You should review this code before allowing it to be compiled and executed.")
-		fmt.Println()
-		fmt.Println("If you allow this action, GPT is able to execute code with the same permissions as your user.")
-		fmt.Println()
-		color.New(color.FgHiWhite, color.Bold).Println("This is potentially dangerous.")
-		fmt.Println()
-		fmt.Println("The source code GPT has written can be found here:")
-		fmt.Println(sourcePath)
-		fmt.Println()
-		confirmation := ui.PromptInput("Enter 'confirm' to confirm, anything else will block:")
-		if confirmation != "confirm" {
-			fmt.Println()
-			fmt.Println("============================================================")
-			return "The user has prevented you from running this code", errors.New(confirmation)
+	if module.ConfigFromContext(ctx, m.cfg).IsSupervisedMode() {
+		err := module.Approve(ctx, module.ApprovalRequest{
+			Warning: "⚠️ GPT written plugins are untrusted code from the internet",
+			Details: `You should review this code before allowing it to be compiled and executed.
+
+If you allow this action, GPT is able to execute code with the same permissions as your user.
+
+This is potentially dangerous.
+
+The source code GPT has written can be found here:
+` + sourcePath,
+			Content: source,
+		})
+		if err != nil {
+			return "The user has prevented you from running this code", err
 		}
-		fmt.Println()
-		fmt.Println("============================================================")
-		fmt.Println()
 	}
 
 	pluginPath := PluginCompilePath + "/" + id + ".so"
-	cmd := exec.Command("go", "build", "-buildmode=plugin", "-o", pluginPath, sourcePath)
+	cmd := exec.CommandContext(ctx, "go", "build", "-buildmode=plugin", "-o", pluginPath, sourcePath)
 	if b, err := cmd.CombinedOutput(); err != nil {
 		return string(b), fmt.Errorf("error compiling plugin: %s", err)
 	}
@@ -174,7 +173,7 @@ func (m *Module) createPlugin(id, body string) (string, error) {
 		return "", errors.New("ID() does not return the ID specified in the '/plugin create <plugin-id>' command")
 	}
 
-	err = module.LoadPlugin(module.GetModuleForPlugin(loadedPlugin))
+	err = registry.LoadPlugin(module.GetModuleForPlugin(loadedPlugin))
 	if err != nil {
 		return "", fmt.Errorf("error loading plugin: %s", err)
 	}
@@ -193,7 +192,7 @@ The interface you need to implement is:
 ` + util.TripleQuote + `
 type Plugin interface {
 	Example() string
-	Execute(input map[string]any) (map[string]any, error)
+	Execute(ctx context.Context, input map[string]any) (map[string]any, error)
 }
 ` + util.TripleQuote + `
 
@@ -203,7 +202,11 @@ Here's the full code for the "add 1" plugin you can use to guide your output:
 ` + util.TripleQuote + `
 package main
 
-import "github.com/ian-kent/gptchat/module"
+import (
+	"context"
+
+	"github.com/ian-kent/gptchat/module"
+)
 
 var Plugin module.Plugin = AddOne{}
 
@@ -219,7 +222,7 @@ func (c AddOne) Example() string {
 }` + util.SingleQuote + `
 }
 
-func (c AddOne) Execute(input map[string]any) (map[string]any, error) {
+func (c AddOne) Execute(ctx context.Context, input map[string]any) (map[string]any, error) {
 	value, ok := input["value"].(int)
 	if !ok {
 		return nil, nil
@@ -239,6 +242,8 @@ Your plugin must import the module package and must define a package variable na
 
 The input to Execute is a map[string]any which you should assume is unmarshaled from JSON. This means you must use appropriate data types, for example a float64 when working with numbers.
 
+If your plugin does anything which might take a long time, for example calling an API, it should stop when the context passed to Execute is cancelled.
+
 To create a plugin, you should use the "/plugin create <plugin-id> {}" command, for example:
 
 ` + util.TripleQuote + `
@@ -0,0 +1,101 @@
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ian-kent/gptchat/provider"
+)
+
+// validToolName matches the tool names accepted by the OpenAI API
+var validToolName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// toolParameters describes the arguments of a module tool, which are the
+// same as the arguments to the equivalent slash command
+var toolParameters = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"args": map[string]any{
+			"type":        "string",
+			"description": "The subcommand and any arguments, for example 'store' to call '/memory store'",
+		},
+		"body": map[string]any{
+			"type":        "string",
+			"description": "The command body, which would otherwise be between {} after the command",
+		},
+	},
+}
+
+type toolArguments struct {
+	Args string          `json:"args"`
+	Body json.RawMessage `json:"body"`
+}
+
+// Tools returns a tool for each loaded module, for use with function calling
+func Tools() []provider.Tool {
+	return defaultRegistry.Tools()
+}
+
+func (r *Registry) Tools() []provider.Tool {
+	var tools []provider.Tool
+	for _, mod := range r.Loaded() {
+		id := mod.ID()
+		if !validToolName.MatchString(id) {
+			continue
+		}
+
+		tools = append(tools, provider.Tool{
+			Name: id,
+			Description: fmt.Sprintf(`Calls the /%s command.
+
+Here's how the command is used:
+
+%s`, id, mod.Prompt()),
+			Parameters: toolParameters,
+		})
+	}
+
+	return tools
+}
+
+// ExecuteToolCall executes the module named by a tool call
+func ExecuteToolCall(ctx context.Context, toolCall provider.ToolCall) (bool, *CommandResult) {
+	return defaultRegistry.ExecuteToolCall(ctx, toolCall)
+}
+
+// IsSerialToolCall returns true if the command called by a tool call must be executed on its own
+func (r *Registry) IsSerialToolCall(toolCall provider.ToolCall) bool {
+	var input toolArguments
+	// invalid arguments are reported when the tool call is executed
+	_ = json.Unmarshal([]byte(toolCall.Arguments), &input)
+	return r.IsSerial(toolCall.Name, input.Args)
+}
+
+func (r *Registry) ExecuteToolCall(ctx context.Context, toolCall provider.ToolCall) (bool, *CommandResult) {
+	var input toolArguments
+	if strings.TrimSpace(toolCall.Arguments) != "" {
+		if err := json.Unmarshal([]byte(toolCall.Arguments), &input); err != nil {
+			return true, &CommandResult{
+				Error: fmt.Errorf("tool arguments must be valid json: %s", err),
+			}
+		}
+	}
+
+	// the body should be a string, but if GPT has given us a JSON object
+	// instead we can pass it to the module as it is
+	var body string
+	if len(input.Body) > 0 && json.Unmarshal(input.Body, &body) != nil {
+		body = string(input.Body)
+	}
+
+	// modules expect the body to be wrapped in {} like a slash command
+	body = strings.TrimSpace(body)
+	if body != "" && !strings.HasPrefix(body, "{") {
+		body = "{\n" + body + "\n}"
+	}
+
+	return r.ExecuteCommand(ctx, "/"+toolCall.Name, strings.TrimSpace(input.Args), body)
+}
@@ -0,0 +1,57 @@
+package module
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoModule struct{}
+
+func (echoModule) Load(config.Config, provider.Provider) error { return nil }
+func (echoModule) UpdateConfig(config.Config)                  {}
+func (echoModule) ID() string                                  { return "echo" }
+func (echoModule) Prompt() string                              { return "/echo <args> {body}" }
+func (echoModule) Execute(ctx context.Context, args, body string) (string, error) {
+	return args + "|" + body, nil
+}
+
+func TestExecuteToolCall(t *testing.T) {
+	registry := NewRegistry()
+	registry.Load(config.New(), nil, echoModule{})
+
+	tools := registry.Tools()
+	assert.Len(t, tools, 1)
+	assert.Equal(t, "echo", tools[0].Name)
+	assert.Contains(t, tools[0].Description, "/echo <args> {body}")
+
+	testCases := []struct {
+		name      string
+		arguments string
+		output    string
+	}{
+		{"no arguments", ``, "/echo <args> {body}"},
+		{"args only", `{"args": "store"}`, "store|"},
+		{"body with braces", `{"args": "store", "body": "{ value }"}`, "store|{ value }"},
+		{"body without braces", `{"args": "store", "body": "value"}`, "store|{\nvalue\n}"},
+		{"json object body", `{"body": {"value": 5}}`, `|{"value": 5}`},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ok, result := registry.ExecuteToolCall(context.Background(), provider.ToolCall{Name: "echo", Arguments: testCase.arguments})
+			assert.True(t, ok)
+			assert.NoError(t, result.Error)
+			assert.Equal(t, testCase.output, result.Prompt)
+		})
+	}
+
+	_, result := ExecuteToolCall(context.Background(), provider.ToolCall{Name: "echo", Arguments: `not json`})
+	assert.Error(t, result.Error)
+
+	_, result = ExecuteToolCall(context.Background(), provider.ToolCall{Name: "missing"})
+	assert.EqualError(t, result.Error, "Unrecognised command: /missing")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/secret"
+	"github.com/ian-kent/gptchat/session"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/mattn/go-isatty"
+)
+
+// readPrompt returns the prompt to use for a non-interactive run, combining
+// the --prompt flag with anything piped in using stdin.
+//
+// If there's a prompt, stdin is only read if it's redirected from a file or
+// readStdin is true, since a parent process can leave stdin open without
+// writing to it, for example under cron or in CI, and we'd wait forever.
+//
+// An empty prompt means we should start an interactive conversation.
+func readPrompt(flag string, readStdin bool, stdin *os.File) (string, error) {
+	prompt := strings.TrimSpace(flag)
+	if isatty.IsTerminal(stdin.Fd()) || isatty.IsCygwinTerminal(stdin.Fd()) {
+		return prompt, nil
+	}
+	if prompt != "" && !readStdin && !isFile(stdin) {
+		return prompt, nil
+	}
+
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", err
+	}
+
+	input := strings.TrimSpace(string(b))
+	switch {
+	case input == "" && prompt == "":
+		return "", errors.New("no prompt was provided")
+	case input == "":
+		return prompt, nil
+	case prompt == "":
+		return input, nil
+	default:
+		return prompt + "\n\n" + input, nil
+	}
+}
+
+// isFile returns true if f is a regular file, for example because stdin
+// is redirected from one
+func isFile(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// runNonInteractive sends a single prompt to GPT and prints its final response to stdout.
+//
+// Everything else is printed to stderr, and nothing is read from stdin, so
+// anything which needs approval in supervised mode is blocked.
+func runNonInteractive(prompt string) error {
+	ui.SetOutput(os.Stderr)
+
+	if err := setup(false); err != nil {
+		return err
+	}
+
+	// the response is only printed once it's complete
+	cfg = cfg.WithStreamingMode(false)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx = module.WithApprover(ctx, module.DenyApprover{})
+
+	response, err := session.New(cfg, client, module.Default()).Run(ctx, prompt)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(os.Stdout, secret.Redact(response)+"\n")
+	return err
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadPrompt(t *testing.T) {
+	// pipe returns a pipe with input written to it, which is left open
+	// if input is empty, like stdin under cron or in CI
+	pipe := func(input string) *os.File {
+		r, w, err := os.Pipe()
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			r.Close()
+			w.Close()
+		})
+		if input != "" {
+			_, err = w.WriteString(input)
+			require.NoError(t, err)
+			w.Close()
+		}
+		return r
+	}
+	file := func(input string) *os.File {
+		path := filepath.Join(t.TempDir(), "prompt.txt")
+		require.NoError(t, ioutil.WriteFile(path, []byte(input), 0600))
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { f.Close() })
+		return f
+	}
+
+	tests := []struct {
+		name      string
+		flag      string
+		readStdin bool
+		stdin     *os.File
+		prompt    string
+		err       bool
+	}{
+		{name: "prompt only", flag: "summarise", stdin: pipe(""), prompt: "summarise"},
+		{name: "prompt ignores a pipe", flag: "summarise", stdin: pipe("some text"), prompt: "summarise"},
+		{name: "pipe", stdin: pipe("some text"), prompt: "some text"},
+		{name: "empty pipe", stdin: pipe(" \n"), err: true},
+		{name: "prompt and file", flag: "summarise", stdin: file("some text\n"), prompt: "summarise\n\nsome text"},
+		{name: "prompt and --stdin", flag: "summarise", readStdin: true, stdin: pipe("some text"), prompt: "summarise\n\nsome text"},
+		{name: "--stdin with nothing piped in", flag: "summarise", readStdin: true, stdin: file(""), prompt: "summarise"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			prompt, err := readPrompt(test.flag, test.readStdin, test.stdin)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.prompt, prompt)
+		})
+	}
+}
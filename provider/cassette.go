@@ -0,0 +1,352 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ian-kent/gptchat/secret"
+)
+
+// ErrCassetteMismatch is returned when replaying a cassette which doesn't have a
+// response for a request, usually because a prompt has changed since it was recorded
+var ErrCassetteMismatch = errors.New("the request doesn't match the cassette")
+
+// CassetteVersion is the version of the cassette file format
+const CassetteVersion = 1
+
+const (
+	interactionChat       = "chat"
+	interactionEmbeddings = "embeddings"
+)
+
+// Interaction is a request which was recorded in a cassette, along with its response
+type Interaction struct {
+	Kind  string `json:"kind"`
+	Model string `json:"model"`
+
+	// Messages, Tools and N are set for chat requests
+	Messages []Message `json:"messages,omitempty"`
+	Tools    []string  `json:"tools,omitempty"`
+	N        int       `json:"n,omitempty"`
+	// Input is set for embedding requests
+	Input []string `json:"input,omitempty"`
+
+	Response *Message `json:"response,omitempty"`
+	// Choices are every response, if more than one was requested
+	Choices []Message `json:"choices,omitempty"`
+	// ResponseModel is the model which generated the response, if the API said
+	ResponseModel string      `json:"response_model,omitempty"`
+	Embeddings    [][]float32 `json:"embeddings,omitempty"`
+}
+
+type cassetteFile struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Cassette is a Provider which either records the requests made using another
+// provider, along with their responses, or replays them from a file without
+// using the API. This makes it possible to test whole conversations.
+//
+// When replaying, each request must match one which was recorded, so a
+// change to a prompt is spotted rather than silently getting the old response.
+type Cassette struct {
+	mu   sync.Mutex
+	path string
+
+	// provider is nil when replaying
+	provider     Provider
+	interactions []Interaction
+	used         []bool
+
+	// ignore matches parts of messages which change every time, like dates
+	ignore []*regexp.Regexp
+}
+
+// Record returns a Cassette which uses p, and saves each request and response to path
+func Record(p Provider, path string) *Cassette {
+	return &Cassette{
+		path:     path,
+		provider: p,
+	}
+}
+
+// Replay returns a Cassette which responds to requests using the responses in path
+func Replay(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading cassette: %s", err)
+	}
+
+	var file cassetteFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("error loading cassette: %s", err)
+	}
+	if file.Version > CassetteVersion {
+		return nil, fmt.Errorf("cassette version %d isn't supported", file.Version)
+	}
+
+	return &Cassette{
+		path:         path,
+		interactions: file.Interactions,
+		used:         make([]bool, len(file.Interactions)),
+	}, nil
+}
+
+// Ignore makes the cassette ignore anything matching patterns when comparing
+// messages, for things which change every time a conversation is run, like dates
+func (c *Cassette) Ignore(patterns ...*regexp.Regexp) *Cassette {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ignore = append(c.ignore, patterns...)
+	return c
+}
+
+// Remaining returns the number of recorded requests which haven't been replayed
+func (c *Cassette) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var remaining int
+	for _, used := range c.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func (c *Cassette) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	if c.provider == nil {
+		interaction, err := c.replay(chatInteraction(req))
+		if err != nil {
+			return ChatResponse{}, err
+		}
+		messages := interaction.Choices
+		if len(messages) == 0 {
+			messages = []Message{*interaction.Response}
+		}
+		resp := ChatResponse{Model: interaction.ResponseModel}
+		for _, message := range messages {
+			resp.Choices = append(resp.Choices, Choice{Message: message, FinishReason: finishReason(message)})
+		}
+		return resp, nil
+	}
+
+	resp, err := c.provider.CreateChatCompletion(ctx, req)
+	if err != nil || len(resp.Choices) == 0 {
+		return resp, err
+	}
+
+	interaction := chatInteraction(req)
+	interaction.Response = &resp.Choices[0].Message
+	interaction.ResponseModel = resp.Model
+	if len(resp.Choices) > 1 {
+		for _, choice := range resp.Choices {
+			interaction.Choices = append(interaction.Choices, choice.Message)
+		}
+	}
+	return resp, c.record(interaction)
+}
+
+func (c *Cassette) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (ChatStream, error) {
+	if c.provider == nil {
+		interaction, err := c.replay(chatInteraction(req))
+		if err != nil {
+			return nil, err
+		}
+		return &fakeChatStream{chunks: chunkMessage(interaction.ResponseModel, *interaction.Response)}, nil
+	}
+
+	stream, err := c.provider.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return &recordingStream{
+		stream:      stream,
+		cassette:    c,
+		interaction: chatInteraction(req),
+	}, nil
+}
+
+func (c *Cassette) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error) {
+	interaction := Interaction{
+		Kind:  interactionEmbeddings,
+		Model: req.Model,
+		Input: req.Input,
+	}
+
+	if c.provider == nil {
+		recorded, err := c.replay(interaction)
+		if err != nil {
+			return EmbeddingResponse{}, err
+		}
+		return EmbeddingResponse{Embeddings: recorded.Embeddings}, nil
+	}
+
+	resp, err := c.provider.CreateEmbeddings(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	interaction.Embeddings = resp.Embeddings
+	return resp, c.record(interaction)
+}
+
+func chatInteraction(req ChatRequest) Interaction {
+	interaction := Interaction{
+		Kind:     interactionChat,
+		Model:    req.Model,
+		Messages: req.Messages,
+		N:        req.N,
+	}
+	// the tool descriptions are part of the code rather than the
+	// conversation, so only the names are compared
+	for _, tool := range req.Tools {
+		interaction.Tools = append(interaction.Tools, tool.Name)
+	}
+	return interaction
+}
+
+// finishReason returns the reason a model would have stopped generating message
+func finishReason(message Message) string {
+	if len(message.ToolCalls) > 0 {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// record adds an interaction to the cassette and saves it
+func (c *Cassette) record(interaction Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+
+	b, err := json.MarshalIndent(cassetteFile{
+		Version:      CassetteVersion,
+		Interactions: c.interactions,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = []byte(secret.Redact(string(b)))
+	if err := ioutil.WriteFile(c.path, b, 0600); err != nil {
+		return fmt.Errorf("error saving cassette: %s", err)
+	}
+	return nil
+}
+
+// replay returns the first recorded interaction which hasn't been used and
+// matches the request. Commands can be executed concurrently, so requests
+// don't have to be made in exactly the order they were recorded.
+func (c *Cassette) replay(req Interaction) (Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	next := -1
+	for i, interaction := range c.interactions {
+		if c.used[i] || interaction.Kind != req.Kind {
+			continue
+		}
+		if next == -1 {
+			next = i
+		}
+		if c.difference(interaction, req) == "" {
+			c.used[i] = true
+			return interaction, nil
+		}
+	}
+
+	if next == -1 {
+		return Interaction{}, fmt.Errorf("%w: there are no more %s requests in %s", ErrCassetteMismatch, req.Kind, c.path)
+	}
+	return Interaction{}, fmt.Errorf("%w: %s", ErrCassetteMismatch, c.difference(c.interactions[next], req))
+}
+
+// difference describes the first difference between a recorded request and a new one, mu must be held
+func (c *Cassette) difference(recorded, req Interaction) string {
+	if recorded.Model != req.Model {
+		return fmt.Sprintf("the model was %s but is now %s", recorded.Model, req.Model)
+	}
+	if recorded.N != req.N {
+		return fmt.Sprintf("%d responses were requested but now it's %d", recorded.N, req.N)
+	}
+	if !reflect.DeepEqual(recorded.Tools, req.Tools) {
+		return fmt.Sprintf("the tools were %v but are now %v", recorded.Tools, req.Tools)
+	}
+	if !reflect.DeepEqual(recorded.Input, req.Input) {
+		return fmt.Sprintf("the input was %q but is now %q", recorded.Input, req.Input)
+	}
+	for i := 0; i < len(recorded.Messages) && i < len(req.Messages); i++ {
+		a, b := recorded.Messages[i], req.Messages[i]
+		if a.Role != b.Role || c.normalise(a.Content) != c.normalise(b.Content) || a.ToolCallID != b.ToolCallID || !reflect.DeepEqual(a.ToolCalls, b.ToolCalls) {
+			return fmt.Sprintf("message %d was %s %q but is now %s %q", i, a.Role, shorten(a.Content), b.Role, shorten(b.Content))
+		}
+	}
+	if len(recorded.Messages) != len(req.Messages) {
+		return fmt.Sprintf("there were %d messages but there are now %d", len(recorded.Messages), len(req.Messages))
+	}
+	return ""
+}
+
+func (c *Cassette) normalise(content string) string {
+	for _, pattern := range c.ignore {
+		content = pattern.ReplaceAllString(content, "")
+	}
+	return content
+}
+
+func shorten(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
+
+// recordingStream records a streamed response once it's complete
+type recordingStream struct {
+	stream      ChatStream
+	cassette    *Cassette
+	interaction Interaction
+
+	content   strings.Builder
+	toolCalls []ToolCall
+}
+
+func (s *recordingStream) Recv() (ChatStreamChunk, error) {
+	chunk, err := s.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.interaction.Response = &Message{
+			Role:      RoleAssistant,
+			Content:   s.content.String(),
+			ToolCalls: s.toolCalls,
+		}
+		if recordErr := s.cassette.record(s.interaction); recordErr != nil {
+			return chunk, recordErr
+		}
+		return chunk, err
+	}
+	if err != nil {
+		return chunk, err
+	}
+
+	if chunk.Model != "" {
+		s.interaction.ResponseModel = chunk.Model
+	}
+	s.content.WriteString(chunk.Content)
+	s.toolCalls = AppendToolCallDeltas(s.toolCalls, chunk.ToolCalls)
+	return chunk, nil
+}
+
+func (s *recordingStream) Close() error {
+	return s.stream.Close()
+}
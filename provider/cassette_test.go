@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCassette(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ctx := context.Background()
+
+	first := ChatRequest{Model: "gpt-4", Messages: []Message{{Role: RoleUser, Content: "Hello at 10:00"}}}
+	second := ChatRequest{Model: "gpt-4", Messages: []Message{{Role: RoleUser, Content: "Stream something"}}}
+	embeddings := EmbeddingRequest{Model: "text-embedding-3-small", Input: []string{"cats"}}
+
+	recorder := Record(NewFake("Hi there", "A streamed response"), path)
+	_, err := recorder.CreateChatCompletion(ctx, first)
+	require.NoError(t, err)
+	stream, err := recorder.CreateChatCompletionStream(ctx, second)
+	require.NoError(t, err)
+	for {
+		if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	recorded, err := recorder.CreateEmbeddings(ctx, embeddings)
+	require.NoError(t, err)
+
+	player, err := Replay(path)
+	require.NoError(t, err)
+	player.Ignore(regexp.MustCompile(`\d{2}:\d{2}`))
+	assert.Equal(t, 3, player.Remaining())
+
+	// requests don't have to be made in the same order
+	resp, err := player.CreateEmbeddings(ctx, embeddings)
+	require.NoError(t, err)
+	assert.Equal(t, recorded.Embeddings, resp.Embeddings)
+
+	// the recorded request is matched even though the time has changed
+	first.Messages[0].Content = "Hello at 11:30"
+	chat, err := player.CreateChatCompletion(ctx, first)
+	require.NoError(t, err)
+	assert.Equal(t, "Hi there", chat.Choices[0].Message.Content)
+
+	second.Messages[0].Content = "Stream something else"
+	_, err = player.CreateChatCompletionStream(ctx, second)
+	assert.ErrorIs(t, err, ErrCassetteMismatch)
+	assert.Contains(t, err.Error(), `message 0 was user "Stream something" but is now user "Stream something else"`)
+	assert.Equal(t, 1, player.Remaining())
+}
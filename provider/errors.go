@@ -0,0 +1,43 @@
+package provider
+
+import (
+	"errors"
+	"time"
+)
+
+// Error is returned by a Provider when a request to the API fails
+type Error struct {
+	// StatusCode is the HTTP status code returned by the API, if any
+	StatusCode int
+	// RetryAfter is how long the API asked us to wait before retrying, if it did
+	RetryAfter time.Duration
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns the HTTP status code of a failed request, or 0 if there wasn't one
+func StatusCode(err error) int {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.StatusCode
+	}
+	return 0
+}
+
+// RetryAfter returns how long the API asked us to wait before retrying a failed request,
+// or 0 if it didn't
+func RetryAfter(err error) time.Duration {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,218 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrNoFakeResponses is returned when a Fake has run out of scripted responses
+var ErrNoFakeResponses = errors.New("fake provider has no more responses")
+
+// Fake is a Provider which returns scripted responses in order, and records
+// the requests it receives, for use in tests
+type Fake struct {
+	mu        sync.Mutex
+	responses []fakeResponse
+	requests  []ChatRequest
+}
+
+type fakeResponse struct {
+	message Message
+	err     error
+	// streamErr is returned by a stream once the message has been streamed
+	streamErr error
+}
+
+// NewFake returns a Fake which returns each of the responses in turn
+func NewFake(responses ...string) *Fake {
+	f := &Fake{}
+	for _, response := range responses {
+		f.Respond(response)
+	}
+	return f
+}
+
+// Respond adds a response to the script
+func (f *Fake) Respond(content string) *Fake {
+	return f.RespondMessage(Message{
+		Role:    RoleAssistant,
+		Content: content,
+	})
+}
+
+// RespondMessage adds a response to the script, for example one which includes tool calls
+func (f *Fake) RespondMessage(message Message) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{message: message})
+	return f
+}
+
+// Fail adds an error to the script
+func (f *Fake) Fail(err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{err: err})
+	return f
+}
+
+// FailStream adds a response to the script which fails with err once content
+// has been streamed. It fails straight away if it isn't streamed.
+func (f *Fake) FailStream(content string, err error) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, fakeResponse{
+		message:   Message{Role: RoleAssistant, Content: content},
+		streamErr: err,
+	})
+	return f
+}
+
+// Requests returns the chat requests the Fake has received
+func (f *Fake) Requests() []ChatRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]ChatRequest{}, f.requests...)
+}
+
+func (f *Fake) next(req ChatRequest) (Message, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	return f.nextChoice()
+}
+
+func (f *Fake) nextChoice() (Message, error) {
+	response, err := f.nextResponse()
+	if err != nil {
+		return Message{}, err
+	}
+	if response.streamErr != nil {
+		return Message{}, response.streamErr
+	}
+	return response.message, response.err
+}
+
+func (f *Fake) nextResponse() (fakeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.responses) == 0 {
+		return fakeResponse{}, ErrNoFakeResponses
+	}
+
+	response := f.responses[0]
+	f.responses = f.responses[1:]
+	return response, nil
+}
+
+func (f *Fake) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	message, err := f.next(req)
+	if err != nil {
+		return ChatResponse{}, err
+	}
+
+	resp := ChatResponse{
+		Model: req.Model,
+		Choices: []Choice{
+			{
+				Message:      message,
+				FinishReason: finishReason(message),
+			},
+		},
+	}
+
+	// each extra choice uses the next response in the script
+	for i := 1; i < req.N; i++ {
+		message, err := f.nextChoice()
+		if err != nil {
+			return ChatResponse{}, err
+		}
+		resp.Choices = append(resp.Choices, Choice{Message: message, FinishReason: finishReason(message)})
+	}
+
+	return resp, nil
+}
+
+func (f *Fake) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (ChatStream, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	response, err := f.nextResponse()
+	if err != nil {
+		return nil, err
+	}
+	if response.err != nil {
+		return nil, response.err
+	}
+
+	return &fakeChatStream{chunks: chunkMessage(req.Model, response.message), err: response.streamErr}, nil
+}
+
+// CreateEmbeddings returns a small deterministic vector for each input
+func (f *Fake) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error) {
+	var resp EmbeddingResponse
+	for _, input := range req.Input {
+		h := fnv.New64a()
+		h.Write([]byte(input))
+		sum := h.Sum64()
+
+		embedding := make([]float32, 8)
+		for i := range embedding {
+			embedding[i] = float32((sum>>(i*8))&0xff) / 255
+		}
+		resp.Embeddings = append(resp.Embeddings, embedding)
+	}
+	return resp, nil
+}
+
+// chunkMessage splits a message into word sized chunks to make it look like a real stream
+func chunkMessage(model string, message Message) []ChatStreamChunk {
+	var chunks []ChatStreamChunk
+	for _, word := range strings.SplitAfter(message.Content, " ") {
+		if word != "" {
+			chunks = append(chunks, ChatStreamChunk{Model: model, Content: word})
+		}
+	}
+	if len(message.ToolCalls) > 0 {
+		chunk := ChatStreamChunk{Model: model}
+		for i, toolCall := range message.ToolCalls {
+			chunk.ToolCalls = append(chunk.ToolCalls, ToolCallDelta{
+				Index:     i,
+				ID:        toolCall.ID,
+				Name:      toolCall.Name,
+				Arguments: toolCall.Arguments,
+			})
+		}
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+type fakeChatStream struct {
+	chunks []ChatStreamChunk
+	err    error
+}
+
+func (s *fakeChatStream) Recv() (ChatStreamChunk, error) {
+	if len(s.chunks) == 0 {
+		if s.err != nil {
+			return ChatStreamChunk{}, s.err
+		}
+		return ChatStreamChunk{}, io.EOF
+	}
+
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *fakeChatStream) Close() error {
+	return nil
+}
@@ -0,0 +1,153 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FallbackEntry is a model to fall back to, optionally using a different provider
+type FallbackEntry struct {
+	Model string
+	// Provider is used for requests to Model, or nil to use the same provider
+	Provider Provider
+}
+
+// Fallback is a Provider which moves on to the next model in a list when the
+// model it's using is unavailable.
+//
+// Requests move on straight away if the model doesn't exist or is overloaded.
+// Other server errors are left for the caller to retry, and requests only
+// move on once a model has failed with them ServerErrors times in a row.
+type Fallback struct {
+	// ServerErrors is the number of server errors in a row before a request
+	// moves on to the next model
+	ServerErrors int
+
+	provider Provider
+	entries  []FallbackEntry
+
+	mu       sync.Mutex
+	failures map[int]int
+}
+
+// NewFallback returns a Provider which uses p, and falls back to each of the entries in order
+func NewFallback(p Provider, entries ...FallbackEntry) *Fallback {
+	return &Fallback{
+		ServerErrors: 2,
+		provider:     p,
+		entries:      entries,
+		failures:     make(map[int]int),
+	}
+}
+
+func (f *Fallback) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	var resp ChatResponse
+	err := f.each(ctx, req, func(p Provider, req ChatRequest) error {
+		var err error
+		resp, err = p.CreateChatCompletion(ctx, req)
+		if err == nil && resp.Model == "" {
+			resp.Model = req.Model
+		}
+		return err
+	})
+	return resp, err
+}
+
+func (f *Fallback) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (ChatStream, error) {
+	var stream ChatStream
+	err := f.each(ctx, req, func(p Provider, req ChatRequest) error {
+		var err error
+		stream, err = p.CreateChatCompletionStream(ctx, req)
+		if err == nil {
+			stream = &fallbackStream{ChatStream: stream, model: req.Model}
+		}
+		return err
+	})
+	return stream, err
+}
+
+// CreateEmbeddings doesn't fall back, since embeddings from different models can't be compared
+func (f *Fallback) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error) {
+	return f.provider.CreateEmbeddings(ctx, req)
+}
+
+// each calls fn with the requested model, then each fallback in turn, until
+// one succeeds or fails with an error which shouldn't fall back
+func (f *Fallback) each(ctx context.Context, req ChatRequest, fn func(Provider, ChatRequest) error) error {
+	var err error
+	for i := 0; i <= len(f.entries); i++ {
+		p, r := f.provider, req
+		if i > 0 {
+			entry := f.entries[i-1]
+			r.Model = entry.Model
+			if entry.Provider != nil {
+				p = entry.Provider
+			}
+		}
+
+		err = fn(p, r)
+		if ctx.Err() != nil || !f.fallBack(i, err) {
+			return err
+		}
+	}
+	return err
+}
+
+// fallBack returns true if a request to the ith model which failed with err
+// should move on to the next model
+func (f *Fallback) fallBack(i int, err error) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.failures, i)
+		return false
+	}
+	if ModelNotFound(err) || Overloaded(err) {
+		return true
+	}
+	if StatusCode(err) >= http.StatusInternalServerError {
+		f.failures[i]++
+		return f.failures[i] >= f.ServerErrors
+	}
+	return false
+}
+
+// ModelNotFound returns true if a request failed because the model doesn't
+// exist, or the API key doesn't have access to it
+func ModelNotFound(err error) bool {
+	if err == nil {
+		return false
+	}
+	if StatusCode(err) == http.StatusNotFound {
+		return true
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "model_not_found") || strings.Contains(msg, "does not exist")
+}
+
+// Overloaded returns true if a request failed because the model is overloaded
+func Overloaded(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	// 529 isn't a standard status code, but some APIs use it when they're overloaded
+	return StatusCode(err) == 529 || strings.Contains(strings.ToLower(err.Error()), "overloaded")
+}
+
+// fallbackStream sets the model on chunks where the API doesn't
+type fallbackStream struct {
+	ChatStream
+	model string
+}
+
+func (s *fallbackStream) Recv() (ChatStreamChunk, error) {
+	chunk, err := s.ChatStream.Recv()
+	if err == nil && chunk.Model == "" {
+		chunk.Model = s.model
+	}
+	return chunk, err
+}
@@ -0,0 +1,71 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallback(t *testing.T) {
+	notFound := &Error{StatusCode: http.StatusNotFound, Err: errors.New("The model `gpt-4` does not exist")}
+	serverError := &Error{StatusCode: http.StatusInternalServerError, Err: errors.New("server error")}
+	unauthorized := &Error{StatusCode: http.StatusUnauthorized, Err: errors.New("unauthorized")}
+
+	primary := NewFake().
+		Fail(notFound).Fail(notFound).
+		Fail(serverError).
+		Fail(serverError).Respond("primary").
+		Fail(unauthorized).
+		Fail(notFound).Fail(notFound)
+	other := NewFake("other", "second")
+	f := NewFallback(primary, FallbackEntry{Model: "gpt-3.5-turbo"}, FallbackEntry{Model: "local", Provider: other})
+	req := ChatRequest{Model: "gpt-4"}
+
+	// a missing model falls back straight away
+	resp, err := f.CreateChatCompletion(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "local", resp.Model)
+	assert.Equal(t, "other", resp.Choices[0].Message.Content)
+
+	// a server error is returned so it can be retried, and the second one falls back
+	_, err = f.CreateChatCompletion(context.Background(), req)
+	assert.ErrorIs(t, err, serverError)
+	resp, err = f.CreateChatCompletion(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-3.5-turbo", resp.Model)
+	assert.Equal(t, "primary", resp.Choices[0].Message.Content)
+
+	// errors which another model won't fix don't fall back
+	_, err = f.CreateChatCompletion(context.Background(), req)
+	assert.ErrorIs(t, err, unauthorized)
+
+	var models []string
+	for _, r := range primary.Requests() {
+		models = append(models, r.Model)
+	}
+	assert.Equal(t, []string{"gpt-4", "gpt-3.5-turbo", "gpt-4", "gpt-4", "gpt-3.5-turbo", "gpt-4"}, models)
+
+	// streams fall back in the same way
+	stream, err := f.CreateChatCompletionStream(context.Background(), req)
+	require.NoError(t, err)
+	defer stream.Close()
+	chunk, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "local", chunk.Model)
+	for err == nil {
+		_, err = stream.Recv()
+	}
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestOverloaded(t *testing.T) {
+	assert.True(t, Overloaded(&Error{StatusCode: 529, Err: errors.New("busy")}))
+	assert.True(t, Overloaded(&Error{StatusCode: http.StatusServiceUnavailable, Err: errors.New("The engine is currently overloaded")}))
+	assert.False(t, Overloaded(&Error{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")}))
+	assert.False(t, Overloaded(nil))
+}
@@ -0,0 +1,302 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// OpenAI is a Provider backed by the OpenAI API, or any API which is compatible with it
+type OpenAI struct {
+	client *openai.Client
+
+	// streamUsage asks the API to report usage when streaming,
+	// which isn't supported by every compatible API
+	streamUsage bool
+}
+
+// NewOpenAI returns a Provider for the OpenAI API
+func NewOpenAI(apiKey string) *OpenAI {
+	o := newOpenAI(openai.DefaultConfig(apiKey))
+	o.streamUsage = true
+	return o
+}
+
+// NewOpenAICompatible returns a Provider for an OpenAI compatible API at baseURL,
+// for example a local llama.cpp or vLLM server
+func NewOpenAICompatible(apiKey, baseURL string) *OpenAI {
+	cfg := openai.DefaultConfig(apiKey)
+	cfg.BaseURL = baseURL
+	return newOpenAI(cfg)
+}
+
+// NewAzure returns a Provider for the Azure OpenAI service at endpoint.
+//
+// If deployment is empty, the deployment name is derived from the model name.
+func NewAzure(apiKey, endpoint, deployment string) *OpenAI {
+	cfg := openai.DefaultAzureConfig(apiKey, endpoint)
+	if deployment != "" {
+		cfg.AzureModelMapperFunc = func(string) string {
+			return deployment
+		}
+	}
+	return newOpenAI(cfg)
+}
+
+func newOpenAI(cfg openai.ClientConfig) *OpenAI {
+	// go-openai doesn't give us the response headers when a request fails,
+	// so we capture the ones we need in the transport
+	cfg.HTTPClient = &http.Client{
+		Transport: headerTransport{http.DefaultTransport},
+	}
+	return &OpenAI{
+		client: openai.NewClientWithConfig(cfg),
+	}
+}
+
+func (o *OpenAI) CreateChatCompletion(ctx context.Context, req ChatRequest) (ChatResponse, error) {
+	ctx, headers := withResponseHeaders(ctx)
+	resp, err := o.client.CreateChatCompletion(ctx, toOpenAIChatRequest(req))
+	if err != nil {
+		return ChatResponse{}, wrapError(err, headers)
+	}
+
+	response := ChatResponse{
+		Model: resp.Model,
+		Usage: Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		},
+	}
+	for _, choice := range resp.Choices {
+		response.Choices = append(response.Choices, Choice{
+			Message:      fromOpenAIMessage(choice.Message),
+			FinishReason: string(choice.FinishReason),
+		})
+	}
+
+	return response, nil
+}
+
+func (o *OpenAI) CreateChatCompletionStream(ctx context.Context, req ChatRequest) (ChatStream, error) {
+	ctx, headers := withResponseHeaders(ctx)
+	r := toOpenAIChatRequest(req)
+	if o.streamUsage {
+		r.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+	stream, err := o.client.CreateChatCompletionStream(ctx, r)
+	if err != nil {
+		return nil, wrapError(err, headers)
+	}
+
+	return &openAIChatStream{stream}, nil
+}
+
+func (o *OpenAI) CreateEmbeddings(ctx context.Context, req EmbeddingRequest) (EmbeddingResponse, error) {
+	ctx, headers := withResponseHeaders(ctx)
+	resp, err := o.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Model: openai.EmbeddingModel(req.Model),
+		Input: req.Input,
+	})
+	if err != nil {
+		return EmbeddingResponse{}, wrapError(err, headers)
+	}
+
+	embeddings := make([][]float32, len(req.Input))
+	for _, embedding := range resp.Data {
+		if embedding.Index < len(embeddings) {
+			embeddings[embedding.Index] = embedding.Embedding
+		}
+	}
+
+	return EmbeddingResponse{
+		Embeddings: embeddings,
+		Usage: Usage{
+			PromptTokens: resp.Usage.PromptTokens,
+		},
+	}, nil
+}
+
+type openAIChatStream struct {
+	stream *openai.ChatCompletionStream
+}
+
+func (s *openAIChatStream) Recv() (ChatStreamChunk, error) {
+	resp, err := s.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return ChatStreamChunk{}, io.EOF
+	}
+	if err != nil {
+		return ChatStreamChunk{}, wrapError(err, nil)
+	}
+
+	chunk := ChatStreamChunk{
+		Model: resp.Model,
+	}
+	if resp.Usage != nil {
+		chunk.Usage = &Usage{
+			PromptTokens:     resp.Usage.PromptTokens,
+			CompletionTokens: resp.Usage.CompletionTokens,
+		}
+	}
+	if len(resp.Choices) > 0 {
+		chunk.Content = resp.Choices[0].Delta.Content
+		for i, toolCall := range resp.Choices[0].Delta.ToolCalls {
+			delta := ToolCallDelta{
+				Index:     i,
+				ID:        toolCall.ID,
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			}
+			if toolCall.Index != nil {
+				delta.Index = *toolCall.Index
+			}
+			chunk.ToolCalls = append(chunk.ToolCalls, delta)
+		}
+	}
+
+	return chunk, nil
+}
+
+func (s *openAIChatStream) Close() error {
+	return s.stream.Close()
+}
+
+func toOpenAIChatRequest(req ChatRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		m := openai.ChatCompletionMessage{
+			Role:       message.Role,
+			Content:    message.Content,
+			ToolCallID: message.ToolCallID,
+		}
+		for _, toolCall := range message.ToolCalls {
+			m.ToolCalls = append(m.ToolCalls, openai.ToolCall{
+				ID:   toolCall.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      toolCall.Name,
+					Arguments: toolCall.Arguments,
+				},
+			})
+		}
+		messages = append(messages, m)
+	}
+
+	var tools []openai.Tool
+	for _, tool := range req.Tools {
+		tools = append(tools, openai.Tool{
+			Type: openai.ToolTypeFunction,
+			Function: &openai.FunctionDefinition{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.Parameters,
+			},
+		})
+	}
+
+	return openai.ChatCompletionRequest{
+		Model:       req.Model,
+		Messages:    messages,
+		Tools:       tools,
+		N:           req.N,
+		Temperature: toOpenAIFloat(req.Temperature),
+		TopP:        toOpenAIFloat(req.TopP),
+		MaxTokens:   req.MaxTokens,
+		Stop:        req.Stop,
+		Seed:        req.Seed,
+	}
+}
+
+// toOpenAIFloat converts an optional sampling parameter. The client omits
+// zero values, so 0 is sent as the smallest value above it instead.
+func toOpenAIFloat(f *float32) float32 {
+	if f == nil {
+		return 0
+	}
+	if *f == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return *f
+}
+
+func fromOpenAIMessage(m openai.ChatCompletionMessage) Message {
+	message := Message{
+		Role:       m.Role,
+		Content:    m.Content,
+		ToolCallID: m.ToolCallID,
+	}
+	for _, toolCall := range m.ToolCalls {
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
+	}
+	return message
+}
+
+type responseHeadersKey struct{}
+
+// withResponseHeaders returns a context which captures the headers of the response
+func withResponseHeaders(ctx context.Context) (context.Context, *http.Header) {
+	headers := &http.Header{}
+	return context.WithValue(ctx, responseHeadersKey{}, headers), headers
+}
+
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if headers, ok := req.Context().Value(responseHeadersKey{}).(*http.Header); ok {
+		*headers = resp.Header.Clone()
+	}
+	return resp, nil
+}
+
+func wrapError(err error, headers *http.Header) error {
+	providerErr := &Error{Err: err}
+
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		providerErr.StatusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		providerErr.StatusCode = reqErr.HTTPStatusCode
+	}
+
+	if headers != nil {
+		providerErr.RetryAfter = parseRetryAfter(headers.Get("Retry-After"))
+	}
+
+	return providerErr
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
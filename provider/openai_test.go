@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAICompatible(t *testing.T) {
+	var requests []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := make(map[string]any)
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		if body["stream"] == true {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{"Hello", " there"} {
+				fmt.Fprintf(w, `data: {"model":"local","choices":[{"index":0,"delta":{"content":%q}}]}`+"\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"model":"local","choices":[{"index":0,"message":{"role":"assistant","content":"Hello there"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	p := NewOpenAICompatible("", srv.URL)
+	req := ChatRequest{
+		Model: "local",
+		Messages: []Message{
+			{Role: RoleSystem, Content: "You are a helpful assistant."},
+			{Role: RoleUser, Content: "Hello"},
+		},
+	}
+
+	resp, err := p.CreateChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "local", resp.Model)
+	assert.Equal(t, []Choice{
+		{Message: Message{Role: RoleAssistant, Content: "Hello there"}, FinishReason: "stop"},
+	}, resp.Choices)
+	assert.Equal(t, []any{
+		map[string]any{"role": "system", "content": "You are a helpful assistant."},
+		map[string]any{"role": "user", "content": "Hello"},
+	}, requests[0]["messages"])
+
+	stream, err := p.CreateChatCompletionStream(context.Background(), req)
+	assert.NoError(t, err)
+	defer stream.Close()
+
+	var content string
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		content += chunk.Content
+	}
+	assert.Equal(t, "Hello there", content)
+}
+
+func TestSampling(t *testing.T) {
+	temperature, seed := float32(0), 42
+	req := toOpenAIChatRequest(ChatRequest{
+		Model: "gpt-4",
+		Sampling: Sampling{
+			Temperature: &temperature,
+			MaxTokens:   100,
+			Stop:        []string{"\n"},
+			Seed:        &seed,
+		},
+	})
+
+	// 0 would be omitted, so it's sent as the smallest value above it
+	assert.NotZero(t, req.Temperature)
+	assert.Less(t, req.Temperature, float32(0.0001))
+	assert.Zero(t, req.TopP)
+	assert.Equal(t, 100, req.MaxTokens)
+	assert.Equal(t, []string{"\n"}, req.Stop)
+	assert.Equal(t, &seed, req.Seed)
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake("first").Fail(io.ErrUnexpectedEOF).Respond("third response")
+	req := ChatRequest{Model: "fake"}
+
+	resp, err := f.CreateChatCompletion(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", resp.Choices[0].Message.Content)
+
+	_, err = f.CreateChatCompletion(context.Background(), req)
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	stream, err := f.CreateChatCompletionStream(context.Background(), req)
+	assert.NoError(t, err)
+	var chunks []string
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		chunks = append(chunks, chunk.Content)
+	}
+	assert.Equal(t, []string{"third ", "response"}, chunks)
+
+	_, err = f.CreateChatCompletion(context.Background(), req)
+	assert.Equal(t, ErrNoFakeResponses, err)
+	assert.Len(t, f.Requests(), 4)
+}
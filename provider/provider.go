@@ -0,0 +1,147 @@
+// Package provider defines the interface used to talk to a large language
+// model, so the rest of gptchat doesn't depend on a specific API client.
+package provider
+
+import "context"
+
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// DefaultModel is used when no model has been configured
+const DefaultModel = "gpt-4"
+
+type Provider interface {
+	CreateChatCompletion(context.Context, ChatRequest) (ChatResponse, error)
+	CreateChatCompletionStream(context.Context, ChatRequest) (ChatStream, error)
+	CreateEmbeddings(context.Context, EmbeddingRequest) (EmbeddingResponse, error)
+}
+
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+
+	// ToolCalls are the tools an assistant message asked to call
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// ToolCallID is the tool call a tool message is responding to
+	ToolCallID string `json:"tool_call_id,omitempty"`
+
+	// Model is the model which generated an assistant message, if it's known.
+	// It isn't sent to the API.
+	Model string `json:"model,omitempty"`
+}
+
+type ChatRequest struct {
+	Model    string
+	Messages []Message
+
+	// Tools are the tools the model can call, if it supports function calling
+	Tools []Tool
+
+	// N is the number of responses to generate, each of which is a choice
+	// in the response. 0 generates a single response.
+	N int
+
+	Sampling
+}
+
+// Sampling controls how the model generates a response, anything which
+// isn't set uses the API's default
+type Sampling struct {
+	Temperature *float32
+	TopP        *float32
+	// MaxTokens is the maximum number of tokens in the response, or 0 for no limit
+	MaxTokens int
+	// Stop are sequences which end the response when they're generated
+	Stop []string
+	// Seed asks the API to make responses deterministic, if it supports it
+	Seed *int
+}
+
+// Tool describes a function the model can call
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is a JSON schema describing the arguments
+	Parameters any
+}
+
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Arguments is a JSON object matching the Parameters of the tool
+	Arguments string `json:"arguments"`
+}
+
+type ChatResponse struct {
+	// Model is the model which generated the response, which may be
+	// more specific than the model in the request
+	Model   string
+	Choices []Choice
+	Usage   Usage
+}
+
+// Usage is the number of tokens used by a request, if the API reports it
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+}
+
+type Choice struct {
+	Message      Message
+	FinishReason string
+}
+
+// ChatStream returns a chat response in chunks as it's generated
+type ChatStream interface {
+	// Recv returns the next chunk, or io.EOF once the response is complete
+	Recv() (ChatStreamChunk, error)
+	Close() error
+}
+
+type ChatStreamChunk struct {
+	Model   string
+	Content string
+
+	// ToolCalls are fragments of tool calls, which should be combined
+	// using AppendToolCallDeltas
+	ToolCalls []ToolCallDelta
+
+	// Usage is set on the last chunk if the API reports usage for streams
+	Usage *Usage
+}
+
+type ToolCallDelta struct {
+	// Index identifies which tool call the fragment belongs to
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// AppendToolCallDeltas adds streamed tool call fragments to toolCalls
+func AppendToolCallDeltas(toolCalls []ToolCall, deltas []ToolCallDelta) []ToolCall {
+	for _, delta := range deltas {
+		for len(toolCalls) <= delta.Index {
+			toolCalls = append(toolCalls, ToolCall{})
+		}
+		toolCalls[delta.Index].ID += delta.ID
+		toolCalls[delta.Index].Name += delta.Name
+		toolCalls[delta.Index].Arguments += delta.Arguments
+	}
+	return toolCalls
+}
+
+type EmbeddingRequest struct {
+	Model string
+	Input []string
+}
+
+type EmbeddingResponse struct {
+	// Embeddings contains one vector for each input, in the same order
+	Embeddings [][]float32
+	Usage      Usage
+}
@@ -0,0 +1,138 @@
+// Package retry retries failed API requests with exponential backoff
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/provider"
+)
+
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, which doubles with each attempt
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts, unless the API asks us to wait longer
+	MaxDelay time.Duration
+
+	// OnRetry is called before waiting to retry a failed attempt
+	OnRetry func(err error, attempt int, delay time.Duration)
+}
+
+// FromConfig returns the Policy configured in cfg
+func FromConfig(cfg config.Config) Policy {
+	return Policy{
+		MaxAttempts: cfg.RetryMaxAttempts(),
+		BaseDelay:   cfg.RetryBaseDelay(),
+		MaxDelay:    cfg.RetryMaxDelay(),
+	}
+}
+
+// Retryable returns true if a request which failed with err might succeed if it's retried
+func Retryable(err error) bool {
+	switch provider.StatusCode(err) {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// Delay returns how long to wait before retrying after attempt failed with err
+func (p Policy) Delay(attempt int, err error) time.Duration {
+	if retryAfter := provider.RetryAfter(err); retryAfter > 0 {
+		return retryAfter
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	// add jitter so concurrent requests don't all retry at the same time
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	return delay
+}
+
+// Do calls fn until it succeeds, it fails with an error which isn't retryable,
+// or the maximum number of attempts is reached.
+//
+// The last error returned by fn is returned.
+func (p Policy) Do(ctx context.Context, fn func() error) error {
+	var attempt int
+	for {
+		attempt++
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var stop stopError
+		if errors.As(err, &stop) {
+			return stop.err
+		}
+		if attempt >= p.MaxAttempts || !Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := p.Delay(attempt, err)
+		if p.OnRetry != nil {
+			p.OnRetry(err, attempt, delay)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// stopError stops Do retrying an error which might otherwise be retried
+type stopError struct {
+	err error
+}
+
+func (e stopError) Error() string { return e.err.Error() }
+func (e stopError) Unwrap() error { return e.err }
+
+// Stop returns err so that Do returns it without retrying, for example
+// because part of the response has already been shown to the user
+func Stop(err error) error {
+	return stopError{err: err}
+}
+
+// sleep is a variable so tests can avoid waiting
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
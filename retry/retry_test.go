@@ -0,0 +1,86 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(&provider.Error{StatusCode: http.StatusTooManyRequests, Err: errors.New("rate limited")}))
+	assert.True(t, Retryable(&provider.Error{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}))
+	assert.True(t, Retryable(&provider.Error{Err: context.DeadlineExceeded}))
+	assert.False(t, Retryable(&provider.Error{StatusCode: http.StatusUnauthorized, Err: errors.New("unauthorized")}))
+	assert.False(t, Retryable(context.Canceled))
+	assert.False(t, Retryable(errors.New("error, status code: 429")))
+}
+
+func TestDelay(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	err := errors.New("failed")
+
+	for attempt, max := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		delay := p.Delay(attempt+1, err)
+		assert.GreaterOrEqual(t, delay, max/2)
+		assert.LessOrEqual(t, delay, max)
+	}
+
+	retryAfter := &provider.Error{StatusCode: http.StatusTooManyRequests, RetryAfter: 20 * time.Second, Err: err}
+	assert.Equal(t, 20*time.Second, p.Delay(1, retryAfter))
+}
+
+func TestDo(t *testing.T) {
+	var delays []time.Duration
+	original := sleep
+	t.Cleanup(func() { sleep = original })
+	sleep = func(ctx context.Context, d time.Duration) error {
+		delays = append(delays, d)
+		return nil
+	}
+
+	p := Policy{MaxAttempts: 3}
+	rateLimited := &provider.Error{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Second, Err: errors.New("rate limited")}
+
+	var calls int
+	err := p.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return rateLimited
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []time.Duration{time.Second, time.Second}, delays)
+
+	calls = 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return rateLimited
+	})
+	assert.Equal(t, rateLimited, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	unauthorized := &provider.Error{StatusCode: http.StatusUnauthorized, Err: errors.New("unauthorized")}
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return unauthorized
+	})
+	assert.Equal(t, unauthorized, err)
+	assert.Equal(t, 1, calls)
+
+	// errors which would be retried aren't once Do is told to stop
+	calls = 0
+	err = p.Do(context.Background(), func() error {
+		calls++
+		return Stop(rateLimited)
+	})
+	assert.Equal(t, rateLimited, err)
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,41 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Command runs command using the shell and returns what it prints, for
+// example `pass show openai` or `op read op://Private/OpenAI/credential`.
+//
+// The command can use the terminal to ask for a passphrase, only what it
+// prints to stdout is used.
+func Command(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	var stdout bytes.Buffer
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// the output isn't included in case it's part of the secret
+		return "", fmt.Errorf("error running key command: %s", err)
+	}
+
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", errors.New("the key command didn't print anything")
+	}
+	return secret, nil
+}
@@ -0,0 +1,110 @@
+package secret
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// KeyringService is the service secrets are saved under in the keyring
+const KeyringService = "gptchat"
+
+var (
+	// ErrNoKeyring is returned if there isn't a keyring GPTChat can use
+	ErrNoKeyring = errors.New("no keyring is available")
+	// ErrNotFound is returned if the keyring doesn't have the secret
+	ErrNotFound = errors.New("the secret isn't in the keyring")
+)
+
+// The keyring is used through the tools which come with it, so GPTChat
+// doesn't need cgo: secret-tool for libsecret (GNOME Keyring, KWallet) on
+// Linux, and security for the Keychain on macOS.
+var (
+	secretTool = "secret-tool"
+	security   = "security"
+)
+
+// KeyringAvailable returns true if there's a keyring GPTChat can use
+func KeyringAvailable() bool {
+	_, err := exec.LookPath(keyringTool())
+	return err == nil
+}
+
+func keyringTool() string {
+	if runtime.GOOS == "darwin" {
+		return security
+	}
+	return secretTool
+}
+
+// KeyringGet returns the secret saved for account, for example the
+// name of the provider
+func KeyringGet(account string) (string, error) {
+	if !KeyringAvailable() {
+		return "", ErrNoKeyring
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command(security, "find-generic-password", "-s", KeyringService, "-a", account, "-w")
+	} else {
+		cmd = exec.Command(secretTool, "lookup", "service", KeyringService, "account", account)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		// both tools exit with an error and print nothing if the secret isn't there,
+		// security exits with 44 and secret-tool with 1
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 44 || exitErr.ExitCode() == 1 && stderr.Len() == 0) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("error reading from the keyring: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	secret := strings.TrimSpace(stdout.String())
+	if secret == "" {
+		return "", ErrNotFound
+	}
+	return secret, nil
+}
+
+// KeyringSet saves the secret for account, replacing it if it's already there
+func KeyringSet(account, secret string) error {
+	if !KeyringAvailable() {
+		return ErrNoKeyring
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		// the command is sent using stdin so the password isn't in the arguments,
+		// where other users could see it, and it's hex encoded so it doesn't
+		// need to be quoted
+		cmd = exec.Command(security, "-i")
+		cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", KeyringService, account, hex.EncodeToString([]byte(secret))))
+	} else {
+		cmd = exec.Command(secretTool, "store", "--label", "GPTChat API key ("+account+")", "service", KeyringService, "account", account)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	// security -i doesn't exit with an error if a command fails
+	if err == nil && (runtime.GOOS != "darwin" || stderr.Len() == 0) {
+		return nil
+	}
+	if err == nil {
+		err = errors.New("the command failed")
+	}
+
+	// security might print the command, including the hex encoded password
+	output := strings.ReplaceAll(stderr.String(), hex.EncodeToString([]byte(secret)), Redacted)
+	return fmt.Errorf("error saving to the keyring: %s: %s", err, Redact(strings.TrimSpace(output)))
+}
@@ -0,0 +1,141 @@
+// Package secret finds the API key, and redacts it and any other secrets
+// from everything GPTChat prints or writes
+package secret
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces secrets
+const Redacted = "[REDACTED]"
+
+// minLength is the length of the shortest secret which is redacted, since
+// redacting anything shorter would redact ordinary text
+const minLength = 8
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+)
+
+// Register adds a secret which is redacted from now on
+func Register(secret string) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minLength {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if contains(secrets, secret) {
+		return
+	}
+	secrets = append(secrets, secret)
+
+	// secrets can be written as JSON, where some characters are escaped,
+	// and HTML characters are escaped too unless the encoder is told not to
+	for _, escapeHTML := range []bool{true, false} {
+		escaped := jsonEscape(secret, escapeHTML)
+		if !contains(secrets, escaped) {
+			secrets = append(secrets, escaped)
+		}
+	}
+}
+
+func jsonEscape(s string, escapeHTML bool) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(escapeHTML)
+	if err := enc.Encode(s); err != nil {
+		return s
+	}
+	// remove the quotes and the newline
+	escaped := strings.TrimSuffix(b.String(), "\n")
+	return escaped[1 : len(escaped)-1]
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns s with every secret replaced by Redacted
+func Redact(s string) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Redacted)
+	}
+	return s
+}
+
+// partial returns the length of the longest suffix of s which is the start
+// of a secret, and might be followed by the rest of it
+func partial(s string) int {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	var longest int
+	for _, secret := range secrets {
+		n := len(secret) - 1
+		if n > len(s) {
+			n = len(s)
+		}
+		for ; n > longest; n-- {
+			if strings.HasSuffix(s, secret[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+// NewWriter returns a writer which redacts secrets before writing to w.
+// Each write is redacted on its own, so a secret split between writes isn't
+// redacted, use a Stream for text which arrives in chunks.
+func NewWriter(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+type writer struct {
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Stream redacts secrets from text which arrives in chunks, for example
+// a streamed response. Anything which might be the start of a secret is
+// held back until the next chunk shows whether it is.
+type Stream struct {
+	pending string
+}
+
+// Write returns the text in chunk which is safe to output
+func (s *Stream) Write(chunk string) string {
+	text := Redact(s.pending + chunk)
+	n := len(text) - partial(text)
+	s.pending = text[n:]
+	return text[:n]
+}
+
+// Flush returns the text which has been held back, it must be called once
+// the stream is complete
+func (s *Stream) Flush() string {
+	text := s.pending
+	s.pending = ""
+	return text
+}
@@ -0,0 +1,83 @@
+package secret
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedact(t *testing.T) {
+	Register("sk-test-1234567890")
+	Register(`pass"word&more`)
+	Register("short")
+
+	assert.Equal(t, "the key is [REDACTED].", Redact("the key is sk-test-1234567890."))
+	assert.Equal(t, `{"password":"[REDACTED]"}`, Redact(`{"password":"pass\"word&more"}`))
+	assert.Equal(t, "short", Redact("short"))
+
+	var b bytes.Buffer
+	_, err := NewWriter(&b).Write([]byte("key: sk-test-1234567890\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "key: [REDACTED]\n", b.String())
+}
+
+func TestStream(t *testing.T) {
+	Register("sk-test-1234567890")
+
+	var s Stream
+	var out string
+	for _, chunk := range []string{"the key is s", "k-test-12", "34567890", " and that's it, s", "k"} {
+		out += s.Write(chunk)
+	}
+	assert.Equal(t, "the key is [REDACTED] and that's it, ", out)
+	assert.Equal(t, "sk", s.Flush())
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands need a unix shell")
+	}
+
+	key, err := Command(context.Background(), "echo '  sk-from-command  '")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-from-command", key)
+
+	_, err = Command(context.Background(), "true")
+	assert.Error(t, err)
+
+	_, err = Command(context.Background(), "echo sk-from-command; exit 1")
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "sk-from-command")
+}
+
+func TestKeyring(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake keyring uses secret-tool")
+	}
+
+	// a fake secret-tool which keeps secrets in a directory
+	dir := t.TempDir()
+	script := filepath.Join(dir, "secret-tool")
+	require.NoError(t, ioutil.WriteFile(script, []byte(`#!/bin/sh
+case "$1" in
+lookup) cat "`+dir+`/$5" 2>/dev/null || exit 1 ;;
+store) cat > "`+dir+`/$7" ;;
+esac
+`), 0700))
+	defer func(tool string) { secretTool = tool }(secretTool)
+	secretTool = script
+
+	_, err := KeyringGet("openai")
+	assert.Equal(t, ErrNotFound, err)
+
+	require.NoError(t, KeyringSet("openai", "sk-from-keyring"))
+	key, err := KeyringGet("openai")
+	require.NoError(t, err)
+	assert.Equal(t, "sk-from-keyring", key)
+}
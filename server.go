@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/secret"
+	"github.com/ian-kent/gptchat/session"
+)
+
+// server exposes conversations over HTTP, so other front ends can be
+// built on top of GPTChat.
+//
+//	POST   /sessions                               create a session
+//	GET    /sessions                               list sessions
+//	GET    /sessions/{id}                          get a session and its messages
+//	DELETE /sessions/{id}                          delete a session
+//	POST   /sessions/{id}/messages                 send a message, {"content": "..."}
+//	GET    /sessions/{id}/events                   stream events using Server-Sent Events
+//	POST   /sessions/{id}/approvals/{approval_id}  answer an approval, {"approved": true}
+//	GET    /commands                               list the available commands
+type server struct {
+	mu       sync.Mutex
+	sessions map[string]*serverSession
+}
+
+func newServer() *server {
+	return &server{
+		sessions: make(map[string]*serverSession),
+	}
+}
+
+// serverSession is a conversation which is driven over HTTP
+type serverSession struct {
+	id      string
+	created time.Time
+	chat    *session.Session
+
+	mu          sync.Mutex
+	running     bool
+	cancel      context.CancelFunc
+	subscribers map[chan session.Event]struct{}
+	approvals   map[string]chan approvalAnswer
+}
+
+type approvalAnswer struct {
+	Approved bool   `json:"approved"`
+	Reason   string `json:"reason"`
+}
+
+type sessionResponse struct {
+	ID       string             `json:"id"`
+	Created  time.Time          `json:"created"`
+	Running  bool               `json:"running"`
+	Messages []provider.Message `json:"messages,omitempty"`
+}
+
+type commandResponse struct {
+	ID     string `json:"id"`
+	Prompt string `json:"prompt"`
+}
+
+// subscriberBuffer is the number of events buffered for each subscriber,
+// events are dropped for subscribers which can't keep up
+const subscriberBuffer = 256
+
+var errTurnRunning = errors.New("the session is already responding to a message")
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(path) == 1 && path[0] == "commands":
+		s.handleCommands(w, r)
+	case len(path) == 1 && path[0] == "sessions":
+		s.handleSessions(w, r)
+	case len(path) >= 2 && path[0] == "sessions":
+		sess := s.session(path[1])
+		if sess == nil {
+			writeError(w, http.StatusNotFound, errors.New("session not found"))
+			return
+		}
+
+		switch {
+		case len(path) == 2:
+			s.handleSession(w, r, sess)
+		case len(path) == 3 && path[2] == "messages":
+			s.handleMessages(w, r, sess)
+		case len(path) == 3 && path[2] == "events":
+			s.handleEvents(w, r, sess)
+		case len(path) == 4 && path[2] == "approvals":
+			s.handleApproval(w, r, sess, path[3])
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *server) handleCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+		return
+	}
+
+	var commands []commandResponse
+	for _, mod := range module.Loaded() {
+		commands = append(commands, commandResponse{ID: mod.ID(), Prompt: mod.Prompt()})
+	}
+	writeJSON(w, http.StatusOK, commands)
+}
+
+func (s *server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		sessions := make([]sessionResponse, 0, len(s.sessions))
+		for _, sess := range s.sessions {
+			sessions = append(sessions, sess.response(false))
+		}
+		s.mu.Unlock()
+
+		sort.Slice(sessions, func(i, j int) bool {
+			return sessions[i].Created.Before(sessions[j].Created)
+		})
+		writeJSON(w, http.StatusOK, sessions)
+	case http.MethodPost:
+		sess, err := s.createSession()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, sess.response(true))
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+	}
+}
+
+func (s *server) handleSession(w http.ResponseWriter, r *http.Request, sess *serverSession) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, sess.response(true))
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, sess.id)
+		s.mu.Unlock()
+
+		sess.close()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+	}
+}
+
+func (s *server) handleMessages(w http.ResponseWriter, r *http.Request, sess *serverSession) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error parsing request: %w", err))
+		return
+	}
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" {
+		writeError(w, http.StatusBadRequest, errors.New("content is required"))
+		return
+	}
+
+	err := s.startTurn(sess, func(ctx context.Context) (string, error) {
+		return sess.chat.Send(ctx, req.Content)
+	})
+	if err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, sess.response(false))
+}
+
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request, sess *serverSession) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming isn't supported"))
+		return
+	}
+
+	events := sess.subscribe()
+	defer sess.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// a secret can be split between chunks, so anything which might be
+	// the start of one is held back until the next event
+	var redact secret.Stream
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				// the session has been deleted
+				return
+			}
+			if e.Type == session.EventChunk {
+				if e.Content = redact.Write(e.Content); e.Content == "" {
+					continue
+				}
+			} else if pending := redact.Flush(); pending != "" {
+				writeEvent(w, session.Event{Type: session.EventChunk, Content: pending})
+			}
+			writeEvent(w, e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, e session.Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, secret.Redact(string(b)))
+}
+
+func (s *server) handleApproval(w http.ResponseWriter, r *http.Request, sess *serverSession, approvalID string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed: %s", r.Method))
+		return
+	}
+
+	var answer approvalAnswer
+	if err := json.NewDecoder(r.Body).Decode(&answer); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("error parsing request: %w", err))
+		return
+	}
+
+	sess.mu.Lock()
+	approval, ok := sess.approvals[approvalID]
+	delete(sess.approvals, approvalID)
+	sess.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, errors.New("approval not found"))
+		return
+	}
+
+	approval <- answer
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) session(id string) *serverSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+// createSession creates a new session and, if needed, starts
+// the turn which familiarises GPT with the commands
+func (s *server) createSession() (*serverSession, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	sess := &serverSession{
+		id:          id,
+		created:     time.Now(),
+		chat:        session.New(cfg, client, module.Default()),
+		subscribers: make(map[chan session.Event]struct{}),
+		approvals:   make(map[string]chan approvalAnswer),
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = sess
+	s.mu.Unlock()
+
+	if sess.chat.Start(session.WithEvents(context.Background(), sess.publish)) {
+		err := s.startTurn(sess, func(ctx context.Context) (string, error) {
+			return sess.chat.RunUntilDone(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sess, nil
+}
+
+// startTurn runs turn in the background, unless the session is already running one
+func (s *server) startTurn(sess *serverSession, turn func(ctx context.Context) (string, error)) error {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	if sess.running {
+		return errTurnRunning
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx = module.WithApprover(ctx, sess)
+	ctx = session.WithEvents(ctx, sess.publish)
+
+	sess.running = true
+	sess.cancel = cancel
+
+	go func() {
+		defer cancel()
+
+		response, err := turn(ctx)
+
+		sess.mu.Lock()
+		sess.running = false
+		sess.cancel = nil
+		sess.mu.Unlock()
+
+		if err != nil {
+			sess.publish(session.Event{Type: session.EventError, Error: err.Error()})
+			return
+		}
+		sess.publish(session.Event{Type: session.EventDone, Content: response})
+	}()
+
+	return nil
+}
+
+func (s *serverSession) response(withMessages bool) sessionResponse {
+	s.mu.Lock()
+	running := s.running
+	s.mu.Unlock()
+
+	resp := sessionResponse{
+		ID:      s.id,
+		Created: s.created,
+		Running: running,
+	}
+	if withMessages {
+		resp.Messages = s.chat.Messages()
+	}
+	return resp
+}
+
+func (s *serverSession) subscribe() chan session.Event {
+	events := make(chan session.Event, subscriberBuffer)
+
+	s.mu.Lock()
+	s.subscribers[events] = struct{}{}
+	s.mu.Unlock()
+
+	return events
+}
+
+func (s *serverSession) unsubscribe(events chan session.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[events]; ok {
+		delete(s.subscribers, events)
+		close(events)
+	}
+}
+
+// publish sends an event to every subscriber
+func (s *serverSession) publish(e session.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- e:
+		default:
+		}
+	}
+}
+
+// close cancels any running turn and disconnects all subscribers
+func (s *serverSession) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		s.cancel()
+	}
+	for events := range s.subscribers {
+		delete(s.subscribers, events)
+		close(events)
+	}
+}
+
+// Approve implements module.Approver, by sending an approval event to
+// subscribers and waiting for the approval to be answered using the API
+func (s *serverSession) Approve(ctx context.Context, req module.ApprovalRequest) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+
+	answers := make(chan approvalAnswer, 1)
+	s.mu.Lock()
+	s.approvals[id] = answers
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.approvals, id)
+		s.mu.Unlock()
+	}()
+
+	s.publish(session.Event{
+		Type:       session.EventApproval,
+		ApprovalID: id,
+		Warning:    req.Warning,
+		Details:    req.Details,
+		Content:    req.Content,
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case answer := <-answers:
+		if answer.Approved {
+			return nil
+		}
+		// like the terminal, the reason is passed back to GPT
+		if answer.Reason != "" {
+			return errors.New(answer.Reason)
+		}
+		return module.ErrNotApproved
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(secret.NewWriter(w)).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
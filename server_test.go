@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/session"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	useTestClient(t, "Hello there")
+
+	ts := httptest.NewServer(newServer())
+	defer ts.Close()
+
+	res, err := http.Post(ts.URL+"/sessions", "application/json", nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, res.StatusCode)
+	var sess sessionResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&sess))
+	res.Body.Close()
+
+	// wait for GPT to familiarise itself with the commands
+	assert.Eventually(t, func() bool {
+		res, err := http.Get(ts.URL + "/sessions/" + sess.ID)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&sess))
+		return !sess.Running
+	}, time.Second, 10*time.Millisecond)
+
+	res, err = http.Get(ts.URL + "/sessions/" + sess.ID + "/events")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	post, err := http.Post(ts.URL+"/sessions/"+sess.ID+"/messages", "application/json", strings.NewReader(`{"content":"Hi"}`))
+	require.NoError(t, err)
+	post.Body.Close()
+	assert.Equal(t, http.StatusAccepted, post.StatusCode)
+
+	var events []session.Event
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		data := strings.TrimPrefix(scanner.Text(), "data: ")
+		if data == scanner.Text() {
+			continue
+		}
+		var e session.Event
+		require.NoError(t, json.Unmarshal([]byte(data), &e))
+		events = append(events, e)
+		if e.Type == session.EventDone {
+			break
+		}
+	}
+
+	assert.Equal(t, []session.Event{
+		{Type: session.EventMessage, Content: "Hello there", Model: "gpt-4"},
+		{Type: session.EventDone, Content: "Hello there"},
+	}, events)
+
+	res, err = http.Get(ts.URL + "/sessions/" + sess.ID)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&sess))
+	assert.Len(t, sess.Messages, 7)
+	assert.Equal(t, "Hi", sess.Messages[5].Content)
+}
+
+func TestServerApproval(t *testing.T) {
+	s := newServer()
+	sess := &serverSession{
+		id:          "test",
+		subscribers: make(map[chan session.Event]struct{}),
+		approvals:   make(map[string]chan approvalAnswer),
+	}
+	s.sessions[sess.id] = sess
+	events := sess.subscribe()
+
+	result := make(chan error)
+	go func() {
+		result <- sess.Approve(context.Background(), module.ApprovalRequest{Warning: "careful"})
+	}()
+
+	e := <-events
+	assert.Equal(t, session.EventApproval, e.Type)
+	assert.Equal(t, "careful", e.Warning)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/sessions/test/approvals/"+e.ApprovalID, strings.NewReader(`{"approved":false,"reason":"not today"}`))
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.EqualError(t, <-result, "not today")
+}
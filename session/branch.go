@@ -0,0 +1,212 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ian-kent/gptchat/provider"
+)
+
+// ErrBranchNotFound is returned when switching to a branch which doesn't exist
+var ErrBranchNotFound = errors.New("branch not found")
+
+// branch is one version of the conversation.
+//
+// The history is a tree - undoing or editing a message starts a new branch
+// from the point where the conversation changed, and the old branch is kept
+// so the user can switch back to it. Each branch has its own messages, so
+// GPT only sees the branch it's on.
+type branch struct {
+	ID int `json:"id"`
+	// Parent is the branch this one was started from, or 0 for the first branch
+	Parent int `json:"parent,omitempty"`
+	// Fork is the number of transcript entries the branch shares with its parent
+	Fork       int                `json:"fork"`
+	Messages   []provider.Message `json:"messages"`
+	Transcript []Entry            `json:"transcript"`
+}
+
+// BranchInfo describes a branch of the conversation
+type BranchInfo struct {
+	ID     int
+	Parent int
+	// Current is true for the branch the conversation is on
+	Current bool
+	// Messages is the number of messages in the branch's transcript
+	Messages int
+	// Last is a preview of the user's last message on the branch
+	Last string
+}
+
+// Branches returns every branch of the conversation, in the order they were started
+func (s *Session) Branches() []BranchInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveBranch()
+
+	var branches []BranchInfo
+	for _, b := range s.branches {
+		info := BranchInfo{
+			ID:       b.ID,
+			Parent:   b.Parent,
+			Current:  b.ID == s.branch,
+			Messages: len(b.Transcript),
+		}
+		if i := lastUserEntry(b.Transcript); i >= 0 {
+			info.Last = preview(b.Transcript[i].Content)
+		}
+		branches = append(branches, info)
+	}
+	return branches
+}
+
+// SwitchBranch moves the conversation to another branch
+func (s *Session) SwitchBranch(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveBranch()
+
+	if id < 1 || id > len(s.branches) {
+		return ErrBranchNotFound
+	}
+	s.switchTo(s.branches[id-1])
+	return nil
+}
+
+// Undo removes the user's last message from the conversation, along with
+// everything which happened after it. The old version of the conversation
+// is kept as a branch. It returns false if there's nothing to undo.
+func (s *Session) Undo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := lastUserEntry(s.transcript)
+	if i < 0 {
+		return false
+	}
+	s.fork(i)
+	return true
+}
+
+// UserMessages returns the user's messages on the current branch, in
+// order, so one of them can be edited
+func (s *Session) UserMessages() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var messages []string
+	for _, entry := range s.transcript {
+		if entry.Kind == KindUser {
+			messages = append(messages, entry.Content)
+		}
+	}
+	return messages
+}
+
+// EditMessage starts a new branch where the user's nth message, counting
+// from 1, is replaced by message. Everything after the original message
+// is left on the old branch, so GPT needs to respond to the new one.
+func (s *Session) EditMessage(n int, message string) error {
+	s.mu.Lock()
+
+	at, count := -1, 0
+	for i, entry := range s.transcript {
+		if entry.Kind != KindUser {
+			continue
+		}
+		if count++; count == n {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("there isn't a message %d to edit", n)
+	}
+	s.fork(at)
+	s.mu.Unlock()
+
+	s.AppendMessage(provider.RoleUser, message)
+	return nil
+}
+
+// fork starts a new branch which shares the first n transcript entries with
+// the current branch, and moves the conversation to it. mu must be held.
+func (s *Session) fork(n int) {
+	s.saveBranch()
+
+	current := s.branches[s.branch-1]
+	// a branch which hasn't added anything since it was started is just
+	// part of its parent, so it's rewound rather than starting another one
+	if current.Parent != 0 && len(current.Transcript) == current.Fork && n <= current.Fork {
+		current.Fork = n
+		current.Transcript = current.Transcript[:n]
+		current.Messages = contextMessages(current.Transcript)
+		s.switchTo(current)
+		return
+	}
+
+	transcript := append([]Entry{}, s.transcript[:n]...)
+	b := &branch{
+		ID:         len(s.branches) + 1,
+		Parent:     current.ID,
+		Fork:       n,
+		Messages:   contextMessages(transcript),
+		Transcript: transcript,
+	}
+	s.branches = append(s.branches, b)
+	s.switchTo(b)
+}
+
+// saveBranch copies the conversation to the current branch, starting
+// the first branch if there isn't one yet. mu must be held.
+func (s *Session) saveBranch() {
+	if len(s.branches) == 0 {
+		s.branches = []*branch{{ID: 1}}
+		s.branch = 1
+	}
+	b := s.branches[s.branch-1]
+	b.Messages = append([]provider.Message{}, s.messages...)
+	b.Transcript = append([]Entry{}, s.transcript...)
+}
+
+// switchTo replaces the conversation with branch b. mu must be held.
+func (s *Session) switchTo(b *branch) {
+	s.branch = b.ID
+	s.messages = append([]provider.Message{}, b.Messages...)
+	s.transcript = append([]Entry{}, b.Transcript...)
+	s.guard = loopGuard{}
+	s.outputs = nil
+}
+
+// contextMessages rebuilds the messages sent to GPT from a transcript. Messages
+// which had been evicted are put back, and the next Fit evicts them again if
+// they still don't fit.
+func contextMessages(transcript []Entry) []provider.Message {
+	// only the latest interval prompt is kept in the conversation
+	interval := -1
+	for i, entry := range transcript {
+		if entry.Kind == KindInterval {
+			interval = i
+		}
+	}
+
+	messages := []provider.Message{}
+	for i, entry := range transcript {
+		if entry.Kind == KindSummary || (entry.Kind == KindInterval && i != interval) {
+			continue
+		}
+		messages = append(messages, entry.message())
+	}
+	return messages
+}
+
+// lastUserEntry returns the index of the user's last message in transcript, or -1
+func lastUserEntry(transcript []Entry) int {
+	for i := len(transcript) - 1; i >= 0; i-- {
+		if transcript[i].Kind == KindUser {
+			return i
+		}
+	}
+	return -1
+}
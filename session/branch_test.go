@@ -0,0 +1,69 @@
+package session
+
+import (
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func contents(messages []provider.Message) []string {
+	var result []string
+	for _, message := range messages {
+		result = append(result, message.Content)
+	}
+	return result
+}
+
+func TestBranches(t *testing.T) {
+	s := New(config.New(), provider.NewFake(), module.NewRegistry())
+	s.AppendMessage(provider.RoleSystem, "system")
+	s.AppendMessage(provider.RoleUser, "one")
+	s.AppendMessage(provider.RoleAssistant, "1")
+	s.AppendMessage(provider.RoleUser, "two")
+	s.AppendMessage(provider.RoleAssistant, "2")
+
+	require.True(t, s.Undo())
+	assert.Equal(t, []string{"system", "one", "1"}, contents(s.Messages()))
+	assert.Len(t, s.Transcript(), 3)
+
+	// undoing again rewinds the same branch rather than starting another one
+	require.True(t, s.Undo())
+	assert.Equal(t, []string{"system"}, contents(s.Messages()))
+	assert.False(t, s.Undo())
+
+	require.NoError(t, s.SwitchBranch(1))
+	assert.Equal(t, []string{"one", "two"}, s.UserMessages())
+
+	require.NoError(t, s.EditMessage(2, "three"))
+	s.AppendMessage(provider.RoleAssistant, "3")
+	assert.Equal(t, []string{"system", "one", "1", "three", "3"}, contents(s.Messages()))
+	assert.Error(t, s.EditMessage(5, "five"))
+
+	assert.Equal(t, []BranchInfo{
+		{ID: 1, Messages: 5, Last: "two"},
+		{ID: 2, Parent: 1, Messages: 1},
+		{ID: 3, Parent: 1, Current: true, Messages: 5, Last: "three"},
+	}, s.Branches())
+
+	require.NoError(t, s.SwitchBranch(1))
+	assert.Equal(t, []string{"system", "one", "1", "two", "2"}, contents(s.Messages()))
+	assert.ErrorIs(t, s.SwitchBranch(4), ErrBranchNotFound)
+
+	s.Reset()
+	assert.Len(t, s.Branches(), 1)
+}
+
+func TestContextMessages(t *testing.T) {
+	transcript := []Entry{
+		{Kind: KindSystem, Content: "system"},
+		{Kind: KindSummary, Content: "summary"},
+		{Kind: KindInterval, Content: "interval 1"},
+		{Kind: KindUser, Content: "one"},
+		{Kind: KindInterval, Content: "interval 2"},
+	}
+	assert.Equal(t, []string{"system", "one", "interval 2"}, contents(contextMessages(transcript)))
+}
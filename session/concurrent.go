@@ -0,0 +1,41 @@
+package session
+
+import "sync"
+
+// job is a command from GPT's response waiting to be executed
+type job struct {
+	// serial jobs are run on their own, once every job before them has finished
+	serial bool
+	run    func()
+}
+
+// runJobs runs jobs using up to workers goroutines, or one after another if
+// workers is less than 2. Jobs should store their own results, so they can
+// be used in the original order once runJobs returns.
+func runJobs(workers int, jobs []job) {
+	if workers < 2 {
+		for _, j := range jobs {
+			j.run()
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for _, j := range jobs {
+		if j.serial {
+			wg.Wait()
+			j.run()
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(j job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			j.run()
+		}(j)
+	}
+	wg.Wait()
+}
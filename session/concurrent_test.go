@@ -0,0 +1,80 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunJobs(t *testing.T) {
+	var mu sync.Mutex
+	var running, most int
+	var serialAlone bool
+
+	work := func() {
+		mu.Lock()
+		running++
+		if running > most {
+			most = running
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+	}
+
+	jobs := []job{{run: work}, {run: work}, {run: work}, {serial: true, run: func() {
+		mu.Lock()
+		serialAlone = running == 0
+		mu.Unlock()
+	}}, {run: work}}
+	runJobs(2, jobs)
+
+	assert.Equal(t, 2, most)
+	assert.True(t, serialAlone)
+}
+
+// sleepModule sleeps for the number of milliseconds it's given, then returns them
+type sleepModule struct{}
+
+func (sleepModule) Load(config.Config, provider.Provider) error { return nil }
+func (sleepModule) UpdateConfig(config.Config)                  {}
+func (sleepModule) ID() string                                  { return "sleep" }
+func (sleepModule) Prompt() string                              { return "/sleep <ms>" }
+func (sleepModule) Execute(_ context.Context, args, _ string) (string, error) {
+	d, err := time.ParseDuration(args + "ms")
+	if err != nil {
+		return "", err
+	}
+	time.Sleep(d)
+	return args, nil
+}
+
+func TestExecuteCommandsConcurrently(t *testing.T) {
+	registry := module.NewRegistry()
+	require.NoError(t, registry.Load(config.New(), nil, sleepModule{}))
+
+	s := New(config.New().WithConcurrentCommands(3), nil, registry)
+	response := provider.Message{Role: provider.RoleAssistant, Content: "/sleep 50\n/sleep 10\n/sleep 30"}
+
+	start := time.Now()
+	assert.True(t, s.ExecuteCommands(context.Background(), response))
+	assert.Less(t, time.Since(start), 90*time.Millisecond)
+
+	// the results are in the same order as the commands
+	var outputs []string
+	for _, entry := range s.Transcript() {
+		outputs = append(outputs, entry.Command.Output)
+	}
+	assert.Equal(t, []string{"50", "10", "30"}, outputs)
+}
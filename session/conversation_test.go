@@ -0,0 +1,69 @@
+package session
+
+import (
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/module/memory"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/ian-kent/gptchat/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the conversations in testdata can be recorded again using the OpenAI API with
+//
+//	OPENAI_API_KEY=... go test ./session -run TestConversation -record
+var record = flag.Bool("record", false, "record the conversation tests using the OpenAI API")
+
+// conversation returns a provider which replays the cassette in path, or records it
+func conversation(t *testing.T, path string) provider.Provider {
+	path, err := filepath.Abs(path)
+	require.NoError(t, err)
+
+	if *record {
+		return provider.Record(provider.NewOpenAI(os.Getenv("OPENAI_API_KEY")), path)
+	}
+
+	cassette, err := provider.Replay(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.Zero(t, cassette.Remaining(), "every recorded request should be used")
+	})
+	return cassette.Ignore(util.DatePattern)
+}
+
+func TestConversationMemory(t *testing.T) {
+	ui.SetOutput(io.Discard)
+	client := conversation(t, "testdata/memory.json")
+	// the memory module saves memories in the data directory
+	cfg := config.New().WithOpenAIAPIModel("gpt-4").WithDataDir(t.TempDir())
+	registry := module.NewRegistry()
+	require.NoError(t, registry.Load(cfg, client, &memory.Module{}))
+	s := New(cfg, client, registry)
+
+	_, err := s.Run(context.Background(), "I have two cats called Bob and Alice, please remember that.")
+	require.NoError(t, err)
+
+	// start a new conversation, so GPT has to use its memory
+	s.Reset()
+	response, err := s.Run(context.Background(), "What are my cats called?")
+	require.NoError(t, err)
+	assert.Contains(t, response, "Bob")
+	assert.Contains(t, response, "Alice")
+
+	var commands []string
+	for _, entry := range s.Transcript() {
+		if entry.Command != nil {
+			commands = append(commands, entry.Command.Command+" "+entry.Command.Args)
+		}
+	}
+	assert.Contains(t, commands, "/memory recall")
+}
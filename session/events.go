@@ -0,0 +1,78 @@
+package session
+
+import (
+	"context"
+
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// event types, for example sent to clients in server mode
+const (
+	EventChunk         = "chunk"
+	EventMessage       = "message"
+	EventCommand       = "command"
+	EventCommandResult = "command_result"
+	EventApproval      = "approval"
+	EventRetry         = "retry"
+	EventDebug         = "debug"
+	EventWarning       = "warning"
+	EventDone          = "done"
+	EventError         = "error"
+)
+
+// Event describes something which happened during a turn
+type Event struct {
+	Type       string `json:"type"`
+	Content    string `json:"content,omitempty"`
+	Command    string `json:"command,omitempty"`
+	Args       string `json:"args,omitempty"`
+	Body       string `json:"body,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ApprovalID string `json:"approval_id,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+	Details    string `json:"details,omitempty"`
+	// Name is who a debug message is from, for example ui.AI
+	Name string `json:"name,omitempty"`
+	// Model is the model which generated a message
+	Model string `json:"model,omitempty"`
+}
+
+type eventsKey struct{}
+
+// WithEvents returns a context which sends events to sink
+func WithEvents(ctx context.Context, sink func(Event)) context.Context {
+	return context.WithValue(ctx, eventsKey{}, sink)
+}
+
+// hasEvents returns true if ctx has an event sink, in which case
+// output is sent as events rather than printed to the terminal
+func hasEvents(ctx context.Context) bool {
+	_, ok := ctx.Value(eventsKey{}).(func(Event))
+	return ok
+}
+
+// emit sends an event to the event sink in ctx, if there is one
+func emit(ctx context.Context, e Event) {
+	if sink, ok := ctx.Value(eventsKey{}).(func(Event)); ok {
+		sink(e)
+	}
+}
+
+// debug sends a message which is only shown in debug mode, or prints it
+// if there isn't anything to send events to
+func debug(ctx context.Context, name, message string) {
+	if !hasEvents(ctx) {
+		ui.PrintChatDebug(name, message)
+		return
+	}
+	emit(ctx, Event{Type: EventDebug, Name: name, Content: message})
+}
+
+// warn sends a warning, or prints it if there isn't anything to send events to
+func warn(ctx context.Context, message string) {
+	if !hasEvents(ctx) {
+		ui.Warn(message)
+		return
+	}
+	emit(ctx, Event{Type: EventWarning, Content: message})
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/secret"
+)
+
+// export formats
+const (
+	FormatMarkdown = "md"
+	FormatJSON     = "json"
+)
+
+// TranscriptVersion is the version of the JSON export format, it only
+// changes if the format changes in a way which isn't backwards compatible
+const TranscriptVersion = 1
+
+// Transcript is the JSON export format
+type Transcript struct {
+	Version  int       `json:"version"`
+	Name     string    `json:"name,omitempty"`
+	Model    string    `json:"model"`
+	Exported time.Time `json:"exported"`
+	Entries  []Entry   `json:"entries"`
+}
+
+// ReadTranscript reads a transcript which was exported as JSON
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	var t Transcript
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, fmt.Errorf("error reading transcript: %s", err)
+	}
+	if t.Version != TranscriptVersion {
+		return nil, fmt.Errorf("unsupported transcript version: %d", t.Version)
+	}
+	return &t, nil
+}
+
+// Messages returns the messages in the transcript, in the format they're sent to GPT
+func (t *Transcript) Messages() []provider.Message {
+	var messages []provider.Message
+	for _, entry := range t.Entries {
+		// summaries replace messages the transcript already has
+		if entry.Kind == KindSummary {
+			continue
+		}
+		messages = append(messages, entry.message())
+	}
+	return messages
+}
+
+// Export writes the transcript of the conversation to w using format
+func (s *Session) Export(w io.Writer, format string) error {
+	t := Transcript{
+		Version:  TranscriptVersion,
+		Name:     s.Name(),
+		Model:    s.Config().OpenAIAPIModel(),
+		Exported: time.Now(),
+		Entries:  s.Transcript(),
+	}
+	w = secret.NewWriter(w)
+
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(t)
+	case FormatMarkdown:
+		_, err := io.WriteString(w, t.markdown())
+		return err
+	default:
+		return fmt.Errorf("unsupported format, use %s or %s: %s", FormatMarkdown, FormatJSON, format)
+	}
+}
+
+// kindTitles are the markdown headings for each kind of entry
+var kindTitles = map[string]string{
+	KindSystem:   "System prompt",
+	KindApp:      "GPTChat",
+	KindUser:     "User",
+	KindAI:       "AI",
+	KindInterval: "Interval prompt",
+	KindModule:   "Command result",
+	KindTool:     "Tool result",
+	KindSummary:  "Summary",
+}
+
+func (t *Transcript) markdown() string {
+	var b strings.Builder
+
+	title := "Conversation"
+	if t.Name != "" {
+		title += ": " + t.Name
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "Model: %s  \nExported: %s\n", t.Model, t.Exported.Format(time.RFC1123))
+
+	for _, entry := range t.Entries {
+		heading, ok := kindTitles[entry.Kind]
+		if !ok {
+			heading = entry.Kind
+		}
+		fmt.Fprintf(&b, "\n## %s", heading)
+		if !entry.Time.IsZero() {
+			fmt.Fprintf(&b, " · %s", entry.Time.Format("02 January 2006, 15:04:05"))
+		}
+		b.WriteString("\n\n")
+
+		switch entry.Kind {
+		case KindUser, KindAI:
+			// these are already written as markdown
+			if content := strings.TrimSpace(entry.Content); content != "" {
+				b.WriteString(content + "\n")
+			}
+			for _, toolCall := range entry.ToolCalls {
+				fmt.Fprintf(&b, "\nCalled `/%s`:\n\n%s", toolCall.Name, fence(toolCall.Arguments))
+			}
+		case KindModule, KindTool:
+			if entry.Command == nil {
+				b.WriteString(fence(entry.Content))
+				break
+			}
+			fmt.Fprintf(&b, "Command: `%s`\n", strings.TrimSpace(entry.Command.Command+" "+entry.Command.Args))
+			if entry.Command.Body != "" {
+				fmt.Fprintf(&b, "\nBody:\n\n%s", fence(entry.Command.Body))
+			}
+			if entry.Command.Error != "" {
+				fmt.Fprintf(&b, "\nError:\n\n%s", fence(entry.Command.Error))
+			}
+			if entry.Command.Output != "" {
+				fmt.Fprintf(&b, "\nOutput:\n\n%s", fence(entry.Command.Output))
+			}
+		default:
+			b.WriteString(fence(entry.Content))
+		}
+	}
+
+	return b.String()
+}
+
+// fence wraps text in a code block, using enough backticks that
+// any code blocks in text don't end it early
+func fence(text string) string {
+	ticks := 3
+	var run int
+	for _, c := range text {
+		if c != '`' {
+			run = 0
+			continue
+		}
+		run++
+		if run >= ticks {
+			ticks = run + 1
+		}
+	}
+
+	quote := strings.Repeat("`", ticks)
+	return quote + "\n" + strings.TrimSpace(text) + "\n" + quote + "\n"
+}
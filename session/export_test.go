@@ -0,0 +1,68 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/ian-kent/gptchat/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	s, _ := newTestSession(t, "Let me check.\n/unknown", "Sorry, I can't do that.")
+	_, err := s.Run(context.Background(), "Do something")
+	require.NoError(t, err)
+	s.AddIntervalPrompt()
+
+	var b bytes.Buffer
+	require.NoError(t, s.Export(&b, FormatJSON))
+
+	transcript, err := ReadTranscript(&b)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4", transcript.Model)
+
+	var kinds []string
+	for _, entry := range transcript.Entries {
+		kinds = append(kinds, entry.Kind)
+		assert.False(t, entry.Time.IsZero())
+	}
+	assert.Equal(t, []string{
+		KindSystem, KindApp, KindAI, KindModule, KindAI, KindUser, KindAI, KindModule, KindAI, KindInterval,
+	}, kinds)
+
+	command := transcript.Entries[7].Command
+	require.NotNil(t, command)
+	assert.Equal(t, "/unknown", command.Command)
+	assert.Equal(t, "Unrecognised command: /unknown", command.Error)
+	assert.Equal(t, s.Messages(), transcript.Messages())
+
+	b.Reset()
+	require.NoError(t, s.Export(&b, FormatMarkdown))
+	assert.Contains(t, b.String(), "## Command result")
+	assert.Contains(t, b.String(), "Command: `/unknown`")
+	assert.Contains(t, b.String(), "## Interval prompt")
+	assert.Contains(t, b.String(), "Sorry, I can't do that.")
+
+	assert.Error(t, s.Export(&b, "html"))
+}
+
+func TestFence(t *testing.T) {
+	assert.Equal(t, "```\ntext\n```\n", fence("text"))
+	assert.Equal(t, "````\n```go\ncode\n```\n````\n", fence("```go\ncode\n```"))
+}
+
+func TestExportRedactsSecrets(t *testing.T) {
+	secret.Register("sk-export-1234567890")
+	s, _ := newTestSession(t, "Your key is sk-export-1234567890")
+	_, err := s.Run(context.Background(), "What's my key?")
+	require.NoError(t, err)
+
+	for _, format := range []string{FormatJSON, FormatMarkdown} {
+		var b bytes.Buffer
+		require.NoError(t, s.Export(&b, format))
+		assert.NotContains(t, b.String(), "sk-export-1234567890")
+		assert.Contains(t, b.String(), "Your key is "+secret.Redacted)
+	}
+}
@@ -0,0 +1,106 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoopError is returned by CheckLoop when GPT looks like it's stuck
+// using commands without giving the user a chance to respond
+type LoopError struct {
+	// Reason explains why GPT was stopped
+	Reason string
+	// Turns is the number of turns GPT has taken without input from the user
+	Turns int
+	// Commands are the commands GPT used in those turns, in the order
+	// they were first used, along with the number of times they were used
+	Commands []CommandCount
+}
+
+// CommandCount is the number of times GPT used a command
+type CommandCount struct {
+	Command string
+	Count   int
+}
+
+func (e *LoopError) Error() string {
+	return e.Reason
+}
+
+// Summary describes what GPT has been doing
+func (e *LoopError) Summary() string {
+	result := fmt.Sprintf("%s.\n\nGPT has taken %d turns without any input from you, using these commands:\n", e.Reason, e.Turns)
+	for _, command := range e.Commands {
+		result += fmt.Sprintf("\n    %s", command.Command)
+		if command.Count > 1 {
+			result += fmt.Sprintf(" (%d times)", command.Count)
+		}
+	}
+	return result
+}
+
+// loopGuard keeps track of the commands GPT uses between messages from the user
+type loopGuard struct {
+	turns    int
+	commands []CommandCount
+}
+
+func (g *loopGuard) record(command string) {
+	for i := range g.commands {
+		if g.commands[i].Command == command {
+			g.commands[i].Count++
+			return
+		}
+	}
+	g.commands = append(g.commands, CommandCount{Command: command, Count: 1})
+}
+
+// commandKey identifies a command, so exactly the same command can be detected
+func commandKey(command, args, body string) string {
+	key := strings.TrimSpace(command + " " + args)
+	if body = strings.TrimSpace(body); body != "" {
+		key += " " + body
+	}
+	return key
+}
+
+// CheckLoop should be called each time GPT has used commands and is waiting
+// for the results. It returns a *LoopError if GPT has taken too many turns
+// without input from the user, or keeps using exactly the same command.
+func (s *Session) CheckLoop() error {
+	cfg := s.Config()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.guard.turns++
+
+	var reason string
+	if max := cfg.MaxRepeatedCommands(); max > 0 {
+		for _, command := range s.guard.commands {
+			if command.Count >= max {
+				reason = fmt.Sprintf("GPT has used %s %d times", preview(command.Command), command.Count)
+				break
+			}
+		}
+	}
+	if max := cfg.MaxAutonomousTurns(); reason == "" && max > 0 && s.guard.turns >= max {
+		reason = fmt.Sprintf("GPT has used commands %d times in a row", s.guard.turns)
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &LoopError{
+		Reason:   reason,
+		Turns:    s.guard.turns,
+		Commands: append([]CommandCount{}, s.guard.commands...),
+	}
+}
+
+// ResetLoop lets GPT carry on using commands, as if the user had just responded
+func (s *Session) ResetLoop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.guard = loopGuard{}
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckLoop(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	t.Run("repeated commands", func(t *testing.T) {
+		fake := provider.NewFake("I'm ready.", "/help", "/help", "/help", "/help")
+		s := New(config.New().WithOpenAIAPIModel("gpt-4"), fake, module.NewRegistry())
+
+		_, err := s.Run(context.Background(), "Help")
+		var loopErr *LoopError
+		require.True(t, errors.As(err, &loopErr))
+		assert.Equal(t, "GPT has used /help 3 times", loopErr.Reason)
+		assert.Equal(t, 3, loopErr.Turns)
+		assert.Equal(t, []CommandCount{{Command: "/help", Count: 3}}, loopErr.Commands)
+		assert.Contains(t, loopErr.Summary(), "/help (3 times)")
+	})
+
+	t.Run("too many turns", func(t *testing.T) {
+		fake := provider.NewFake("I'm ready.", "/help", "/unknown", "/other", "Done")
+		cfg := config.New().WithOpenAIAPIModel("gpt-4").WithMaxAutonomousTurns(2)
+		s := New(cfg, fake, module.NewRegistry())
+
+		_, err := s.Run(context.Background(), "Help")
+		var loopErr *LoopError
+		require.True(t, errors.As(err, &loopErr))
+		assert.Equal(t, 2, loopErr.Turns)
+
+		// once the user lets GPT continue, it can carry on
+		s.ResetLoop()
+		response, err := s.RunUntilDone(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "Done", response)
+	})
+
+	t.Run("user input resets the guard", func(t *testing.T) {
+		s := New(config.New().WithMaxRepeatedCommands(2), nil, module.NewRegistry())
+		s.add(KindModule, provider.Message{Role: provider.RoleSystem}, &CommandEntry{Command: "/help"})
+		assert.NoError(t, s.CheckLoop())
+		s.AppendMessage(provider.RoleUser, "Hello")
+		s.add(KindModule, provider.Message{Role: provider.RoleSystem}, &CommandEntry{Command: "/help"})
+		assert.NoError(t, s.CheckLoop())
+	})
+}
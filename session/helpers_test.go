@@ -0,0 +1,22 @@
+package session
+
+import (
+	"io"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// newTestSession returns a session for gpt-4 which doesn't print anything,
+// and the fake provider it uses. GPT familiarises itself with the commands
+// when the session starts, then gives each of the responses in turn.
+func newTestSession(t *testing.T, responses ...string) (*Session, *provider.Fake) {
+	t.Helper()
+	ui.SetOutput(io.Discard)
+
+	fake := provider.NewFake(append([]string{"/help", "I'm ready."}, responses...)...)
+	return New(config.New().WithOpenAIAPIModel("gpt-4"), fake, module.NewRegistry()), fake
+}
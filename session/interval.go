@@ -0,0 +1,93 @@
+package session
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/util"
+)
+
+// interval keeps track of the turns and time since the interval prompt was last added
+type interval struct {
+	turns int
+	since time.Time
+}
+
+func newInterval() interval {
+	return interval{since: time.Now()}
+}
+
+// IntervalPrompt returns the prompt which is occasionally added to the
+// conversation, including the interval prompts of the loaded modules
+func (s *Session) IntervalPrompt() string {
+	cfg := s.Config()
+	prompt := fmt.Sprintf(`The current date and time is %s.`, time.Now().Format(util.DateFormat))
+	for _, modulePrompt := range s.modules.IntervalPrompts() {
+		prompt += "\n\n" + modulePrompt
+	}
+	if !cfg.IsToolsMode() {
+		prompt += `
+
+Remember that the '/help' command will tell you what commands you have available.`
+	}
+	return prompt
+}
+
+// AddIntervalPromptIfDue adds the interval prompt to the conversation if
+// enough turns or time have passed since it was last added, and returns it.
+//
+// It should be called before each request to GPT, since that's what counts as a turn.
+func (s *Session) AddIntervalPromptIfDue() (string, bool) {
+	cfg := s.Config()
+
+	s.mu.Lock()
+	s.interval.turns++
+	due := cfg.IntervalPromptTurns() > 0 && s.interval.turns >= cfg.IntervalPromptTurns()
+	if cfg.IntervalPromptTime() > 0 && time.Since(s.interval.since) >= cfg.IntervalPromptTime() {
+		due = true
+	}
+	s.mu.Unlock()
+
+	if !due {
+		return "", false
+	}
+	return s.AddIntervalPrompt(), true
+}
+
+// AddIntervalPrompt adds the interval prompt to the conversation, and returns it.
+//
+// The previous interval prompt is out of date by now, so it's removed from the
+// conversation rather than letting them pile up, but it's kept in the transcript.
+func (s *Session) AddIntervalPrompt() string {
+	prompt := s.IntervalPrompt()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, ok := s.lastIntervalPrompt(); ok {
+		for i := len(s.messages) - 1; i >= 0; i-- {
+			if s.messages[i].Role == provider.RoleSystem && s.messages[i].Content == previous {
+				s.messages = append(s.messages[:i], s.messages[i+1:]...)
+				break
+			}
+		}
+	}
+
+	message := provider.Message{Role: provider.RoleSystem, Content: prompt}
+	s.messages = append(s.messages, message)
+	s.record(KindInterval, message, nil)
+	s.interval = newInterval()
+
+	return prompt
+}
+
+// lastIntervalPrompt returns the interval prompt which was last added, mu must be held
+func (s *Session) lastIntervalPrompt() (string, bool) {
+	for i := len(s.transcript) - 1; i >= 0; i-- {
+		if s.transcript[i].Kind == KindInterval {
+			return s.transcript[i].Content, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type reminderModule struct{}
+
+func (reminderModule) Load(config.Config, provider.Provider) error { return nil }
+func (reminderModule) UpdateConfig(config.Config)                  {}
+func (reminderModule) ID() string                                  { return "reminder" }
+func (reminderModule) Prompt() string                              { return "/reminder" }
+func (reminderModule) IntervalPrompt() string                      { return "Don't forget /reminder" }
+func (reminderModule) Execute(context.Context, string, string) (string, error) {
+	return "", nil
+}
+
+func TestIntervalPrompt(t *testing.T) {
+	registry := module.NewRegistry()
+	require.NoError(t, registry.Load(config.New(), nil, reminderModule{}))
+
+	s := New(config.New().WithIntervalPromptTurns(2), nil, registry)
+	s.AppendMessage(provider.RoleUser, "Hello")
+
+	_, ok := s.AddIntervalPromptIfDue()
+	assert.False(t, ok)
+	prompt, ok := s.AddIntervalPromptIfDue()
+	require.True(t, ok)
+	assert.Contains(t, prompt, "The current date and time is")
+	assert.Contains(t, prompt, "Don't forget /reminder")
+
+	// the count starts again once the interval prompt has been added
+	_, ok = s.AddIntervalPromptIfDue()
+	assert.False(t, ok)
+	_, ok = s.AddIntervalPromptIfDue()
+	assert.True(t, ok)
+
+	// the old interval prompt is replaced, but is still in the transcript
+	var intervals int
+	for _, message := range s.Messages() {
+		if strings.HasPrefix(message.Content, "The current date and time is") {
+			intervals++
+		}
+	}
+	assert.Equal(t, 1, intervals)
+	assert.Len(t, s.Transcript(), 3)
+}
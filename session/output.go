@@ -0,0 +1,159 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+)
+
+// output is output which was over the limit, kept so GPT can page through it
+type output struct {
+	content []rune
+	limit   int
+}
+
+// outputCommand lets GPT page through output which was over the limit
+const outputCommand = "/output"
+
+// outputTool is outputCommand for function calling
+var outputTool = provider.Tool{
+	Name:        "output",
+	Description: "Returns a page of output from a command which was too long to give you all at once.",
+	Parameters: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "integer",
+				"description": "The id of the output",
+			},
+			"page": map[string]any{
+				"type":        "integer",
+				"description": "The page to return, starting at 1",
+			},
+		},
+		"required": []string{"id", "page"},
+	},
+}
+
+// limitOutput makes sure the output of a command isn't over the limit for its module.
+//
+// Output over the limit has the middle removed, so GPT can still see how it
+// starts and ends, unless output paging is enabled, in which case it's kept
+// so GPT can read the rest of it using the output command.
+func (s *Session) limitOutput(command string, result *module.CommandResult) *module.CommandResult {
+	cfg := s.Config()
+	limit := cfg.OutputLimit(strings.TrimPrefix(command, "/"))
+	content := []rune(result.Prompt)
+	if limit <= 0 || len(content) <= limit {
+		return result
+	}
+
+	limited := *result
+	if cfg.IsOutputPaging() {
+		o := output{content: content, limit: limit}
+		s.mu.Lock()
+		s.outputs = append(s.outputs, o)
+		id := len(s.outputs)
+		s.mu.Unlock()
+
+		limited.Prompt = page(cfg, id, o, 1)
+		return &limited
+	}
+
+	head := limit / 2
+	tail := limit - head
+	limited.Prompt = fmt.Sprintf("%s\n\n[... %d characters were removed because the output was too long ...]\n\n%s",
+		string(content[:head]), len(content)-limit, string(content[len(content)-tail:]))
+	return &limited
+}
+
+// pages returns the number of pages in the output
+func (o output) pages() int {
+	return (len(o.content) + o.limit - 1) / o.limit
+}
+
+// page returns page n of the output, and explains how to read the next one
+func page(cfg config.Config, id int, o output, n int) string {
+	pages := o.pages()
+	end := n * o.limit
+	if end > len(o.content) {
+		end = len(o.content)
+	}
+
+	result := string(o.content[(n-1)*o.limit : end])
+	result += fmt.Sprintf("\n\n[This is page %d of %d of the output.", n, pages)
+	if n < pages {
+		if cfg.IsToolsMode() {
+			result += fmt.Sprintf(" Call the output tool with id %d and page %d to read the next page.", id, n+1)
+		} else {
+			result += fmt.Sprintf(" Use '%s %d %d' to read the next page.", outputCommand, id, n+1)
+		}
+	}
+	return result + "]"
+}
+
+// executeOutputCommand returns a page of output which was stored by limitOutput
+func (s *Session) executeOutputCommand(id, n int) *module.CommandResult {
+	cfg := s.Config()
+
+	s.mu.Lock()
+	var o output
+	ok := id > 0 && id <= len(s.outputs)
+	if ok {
+		o = s.outputs[id-1]
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return &module.CommandResult{Error: fmt.Errorf("there is no output with id %d", id)}
+	}
+	if n < 1 || n > o.pages() {
+		return &module.CommandResult{Error: fmt.Errorf("the output only has %d pages", o.pages())}
+	}
+	return &module.CommandResult{Prompt: page(cfg, id, o, n)}
+}
+
+// executeCommand executes a slash command, including the output command if output paging is enabled
+func (s *Session) executeCommand(ctx context.Context, command, args, body string) (bool, *module.CommandResult) {
+	if command == outputCommand && s.Config().IsOutputPaging() {
+		parts := strings.Fields(args)
+		if len(parts) != 2 {
+			return true, &module.CommandResult{Error: fmt.Errorf("usage: %s <id> <page>", outputCommand)}
+		}
+		id, err1 := strconv.Atoi(parts[0])
+		n, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil {
+			return true, &module.CommandResult{Error: fmt.Errorf("usage: %s <id> <page>", outputCommand)}
+		}
+		return true, s.executeOutputCommand(id, n)
+	}
+
+	ok, result := s.modules.ExecuteCommand(ctx, command, args, body)
+	if !ok {
+		return false, nil
+	}
+	return true, s.limitOutput(command, result)
+}
+
+// executeToolCall executes a tool call, including the output tool if output paging is enabled
+func (s *Session) executeToolCall(ctx context.Context, toolCall provider.ToolCall) *module.CommandResult {
+	if toolCall.Name == outputTool.Name && s.Config().IsOutputPaging() {
+		var input struct {
+			ID   int `json:"id"`
+			Page int `json:"page"`
+		}
+		if err := json.Unmarshal([]byte(toolCall.Arguments), &input); err != nil {
+			return &module.CommandResult{Error: fmt.Errorf("tool arguments must be valid json: %s", err)}
+		}
+		return s.executeOutputCommand(input.ID, input.Page)
+	}
+
+	_, result := s.modules.ExecuteToolCall(ctx, toolCall)
+	return s.limitOutput("/"+toolCall.Name, result)
+}
@@ -0,0 +1,51 @@
+package session
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// alphabetModule returns the alphabet
+type alphabetModule struct{}
+
+func (alphabetModule) Load(config.Config, provider.Provider) error { return nil }
+func (alphabetModule) UpdateConfig(config.Config)                  {}
+func (alphabetModule) ID() string                                  { return "alphabet" }
+func (alphabetModule) Prompt() string                              { return "/alphabet all" }
+func (alphabetModule) Execute(context.Context, string, string) (string, error) {
+	return "abcdefghijklmnopqrstuvwxyz", nil
+}
+
+func TestLimitOutput(t *testing.T) {
+	registry := module.NewRegistry()
+	require.NoError(t, registry.Load(config.New(), nil, alphabetModule{}))
+
+	t.Run("truncate", func(t *testing.T) {
+		s := New(config.New().WithModuleOutputLimit("alphabet", 10), nil, registry)
+		s.ExecuteCommands(context.Background(), provider.Message{Content: "/alphabet all"})
+
+		output := s.Transcript()[0].Command.Output
+		assert.True(t, strings.HasPrefix(output, "abcde\n\n[... 16 characters were removed"))
+		assert.True(t, strings.HasSuffix(output, "]\n\nvwxyz"))
+	})
+
+	t.Run("paging", func(t *testing.T) {
+		s := New(config.New().WithModuleOutputLimit("alphabet", 10).WithOutputPaging(true), nil, registry)
+		s.ExecuteCommands(context.Background(), provider.Message{Content: "/alphabet all"})
+		s.ExecuteCommands(context.Background(), provider.Message{Content: "/output 1 3"})
+		s.ExecuteCommands(context.Background(), provider.Message{Content: "/output 1 4"})
+
+		transcript := s.Transcript()
+		require.Len(t, transcript, 3)
+		assert.Equal(t, "abcdefghij\n\n[This is page 1 of 3 of the output. Use '/output 1 2' to read the next page.]", transcript[0].Command.Output)
+		assert.Equal(t, "uvwxyz\n\n[This is page 3 of 3 of the output.]", transcript[1].Command.Output)
+		assert.Equal(t, "the output only has 3 pages", transcript[2].Command.Error)
+	})
+}
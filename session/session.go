@@ -0,0 +1,353 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/retry"
+	"github.com/ian-kent/gptchat/tokens"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/ian-kent/gptchat/usage"
+	"github.com/ian-kent/gptchat/util"
+	"strings"
+	"sync"
+)
+
+var systemPrompt = `You are a helpful assistant.
+
+You enjoy conversations with the user and like asking follow up questions to gather more information.
+
+You have commands available which you can use to help me.
+
+You can call these commands using the slash command syntax, for example, this is how you call the help command:
+
+` + util.TripleQuote + `
+/help
+` + util.TripleQuote + `
+
+The /help command will give you a list of the commands you have available.
+
+Commands can also include a request body, for example, this is an example of a command which takes an input:
+
+` + util.TripleQuote + `
+/example
+{
+    "expr": "value"
+}
+` + util.TripleQuote + `
+
+Most commands also have subcommands, and this is an example of how you call a subcommand:
+
+` + util.TripleQuote + `
+/example subcommand
+{
+    "expr": "value"
+}
+` + util.TripleQuote + `
+
+To call a command, include the command in your response. You don't need to explain the command response to me, I don't care what it is, I only care that you can use it's output to follow my instructions.`
+
+// toolsSystemPrompt replaces systemPrompt when modules are given to GPT as tools
+var toolsSystemPrompt = `You are a helpful assistant.
+
+You enjoy conversations with the user and like asking follow up questions to gather more information.
+
+You have tools available which you can use to help me.
+
+Each tool is described using a slash command syntax, for example '/example subcommand {body}'. When you call a tool, put the subcommand and any arguments in "args", and anything which would go between {} in "body".
+
+You don't need to explain the tool response to me, I don't care what it is, I only care that you can use it's output to follow my instructions.`
+
+const openingPrompt = `Hello! Please familiarise yourself with the commands you have available.
+
+You must do this before we have a conversation.`
+
+// Session is a conversation with GPT, it owns the message history, the
+// config used for the conversation and the modules GPT can use.
+//
+// Only one turn should run at a time, but the messages and config can be
+// read by other goroutines, so changes are made while holding mu.
+type Session struct {
+	mu       sync.Mutex
+	name     string
+	messages []provider.Message
+	cfg      config.Config
+
+	// transcript is everything which has happened in the conversation,
+	// whereas messages only has what still fits in the context window
+	transcript []Entry
+
+	// guard keeps track of the commands GPT has used since the user last responded
+	guard loopGuard
+	// interval keeps track of when the interval prompt is next due
+	interval interval
+	// outputs are command outputs which were over the limit, for GPT to page through
+	outputs []output
+
+	// branches are the versions of the conversation, and branch is the ID of
+	// the one the conversation is on. There aren't any until the history is
+	// first rewound.
+	branches []*branch
+	branch   int
+
+	client  provider.Provider
+	modules *module.Registry
+	usage   *usage.Tracker
+}
+
+// New returns a session which uses client to talk to GPT, and modules to execute commands
+func New(cfg config.Config, client provider.Provider, modules *module.Registry) *Session {
+	return &Session{
+		cfg:      cfg,
+		client:   client,
+		modules:  modules,
+		usage:    usage.NewTracker(cfg.UsageWarnLimit(), cfg.UsageLimit()),
+		interval: newInterval(),
+	}
+}
+
+// Usage returns the usage of every request made by the session, including
+// requests made by modules
+func (s *Session) Usage() *usage.Tracker {
+	return s.usage
+}
+
+// withUsage returns a context which records the usage of requests against source
+func (s *Session) withUsage(ctx context.Context, source string) context.Context {
+	// warnings about usage are reported in the same way as the session's
+	warnings := usage.WithWarnings(ctx, func(message string) {
+		warn(ctx, message)
+	})
+	return usage.WithSource(usage.WithTracker(warnings, s.usage), source)
+}
+
+func (s *Session) Config() config.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+func (s *Session) SetConfig(cfg config.Config) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = cfg
+}
+
+func (s *Session) AppendMessage(role string, message string) {
+	s.AddMessage(provider.Message{
+		Role:    role,
+		Content: message,
+	})
+}
+
+func (s *Session) AddMessage(message provider.Message) {
+	s.add(kindOf(message), message, nil)
+}
+
+// Reset starts a new conversation, which won't overwrite the saved conversation
+func (s *Session) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.name = ""
+	s.messages = []provider.Message{}
+	s.transcript = nil
+	s.guard = loopGuard{}
+	s.interval = newInterval()
+	s.outputs = nil
+	s.branches = nil
+	s.branch = 0
+}
+
+// DropLastTurn removes GPT's last turn from the conversation, which is its
+// responses since the user's last message along with the output of any
+// commands it used, so GPT can be asked to respond again. It returns false
+// if GPT hasn't responded since the user's last message.
+func (s *Session) DropLastTurn() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	last := -1
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Role == provider.RoleUser {
+			last = i
+			break
+		}
+	}
+	if last == -1 || last == len(s.messages)-1 {
+		return false
+	}
+	s.messages = s.messages[:last+1]
+
+	for i := len(s.transcript) - 1; i >= 0; i-- {
+		if s.transcript[i].Role == provider.RoleUser {
+			s.transcript = s.transcript[:i+1]
+			break
+		}
+	}
+	s.guard = loopGuard{}
+
+	return true
+}
+
+// Messages returns a copy of the messages in the conversation
+func (s *Session) Messages() []provider.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]provider.Message{}, s.messages...)
+}
+
+func (s *Session) setMessages(messages []provider.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = messages
+}
+
+// Start adds the system prompt to the conversation, and returns true
+// if GPT needs to familiarise itself with the commands before we start
+func (s *Session) Start(ctx context.Context) bool {
+	cfg := s.Config()
+
+	prompt := systemPrompt
+	if cfg.IsToolsMode() {
+		prompt = toolsSystemPrompt
+	}
+	s.AppendMessage(provider.RoleSystem, prompt)
+	if cfg.IsDebugMode() {
+		debug(ctx, ui.System, prompt)
+	}
+
+	// tools describe themselves, so there's nothing for GPT to learn
+	if cfg.IsToolsMode() {
+		return false
+	}
+
+	s.add(KindApp, provider.Message{Role: provider.RoleUser, Content: openingPrompt}, nil)
+	if cfg.IsDebugMode() {
+		debug(ctx, ui.User, openingPrompt)
+	}
+	return true
+}
+
+// summaryPrefix starts the message which replaces evicted messages
+// when the summarise context strategy is used
+const summaryPrefix = "Here is a summary of the earlier conversation, which is no longer available to you:\n\n"
+
+// summaryReserve is the number of tokens left free for the summary
+const summaryReserve = 512
+
+// Fit evicts the oldest messages from the conversation
+// once it no longer fits in the context window
+func (s *Session) Fit(ctx context.Context) {
+	cfg := s.Config()
+	messages := s.Messages()
+
+	budget := cfg.ContextBudget()
+	if budget <= 0 {
+		budget = tokens.Budget(cfg.OpenAIAPIModel())
+	}
+	if tokens.CountMessages(messages) <= budget {
+		return
+	}
+
+	summarise := cfg.ContextStrategy() == config.ContextStrategySummarise
+	if summarise {
+		budget -= summaryReserve
+	}
+
+	kept, evicted := tokens.Fit(messages, budget)
+	if len(evicted) == 0 {
+		// only pinned messages are left, there's nothing we can do
+		return
+	}
+	s.setMessages(kept)
+
+	if cfg.IsDebugMode() {
+		result := fmt.Sprintf("Evicted %d messages (%d tokens) from the conversation:\n", len(evicted), tokens.CountMessages(evicted))
+		for _, message := range evicted {
+			result += fmt.Sprintf("\n    [%s] %s", message.Role, preview(message.Content))
+		}
+		debug(ctx, ui.App, result)
+	}
+
+	if !summarise {
+		return
+	}
+
+	summary, err := s.summariseMessages(s.withUsage(ctx, "summary"), cfg, evicted)
+	if err != nil {
+		warn(ctx, fmt.Sprintf("error summarising the conversation, the oldest messages have been dropped: %s", err))
+		return
+	}
+
+	message := provider.Message{
+		Role:    provider.RoleSystem,
+		Content: summaryPrefix + summary,
+	}
+	s.mu.Lock()
+	s.messages = append(kept[:1], append([]provider.Message{message}, kept[1:]...)...)
+	s.record(KindSummary, message, nil)
+	s.mu.Unlock()
+	if cfg.IsDebugMode() {
+		debug(ctx, ui.System, message.Content)
+	}
+}
+
+func (s *Session) summariseMessages(ctx context.Context, cfg config.Config, messages []provider.Message) (string, error) {
+	var transcript string
+	for _, message := range messages {
+		transcript += fmt.Sprintf("%s: %s\n\n", message.Role, message.Content)
+	}
+
+	// summaries can use a cheaper model, but don't use the sampling
+	// parameters, since stop sequences or a low max_tokens would cut them short
+	req := provider.ChatRequest{
+		Model: cfg.ModuleModel("summary"),
+		Messages: []provider.Message{
+			{
+				Role: provider.RoleSystem,
+				Content: `You are a helpful assistant.
+
+I'll give you part of a conversation between a user and an assistant, and I'd like you to summarise it.
+
+The summary must include any facts, decisions and command results which might be needed to continue the conversation. Keep the summary to less than 200 words.`,
+			},
+			{
+				Role: provider.RoleUser,
+				Content: `Here's the conversation:
+
+` + util.TripleQuote + `
+` + transcript + util.TripleQuote,
+			},
+		},
+	}
+
+	var resp provider.ChatResponse
+	err := retry.FromConfig(cfg).Do(ctx, func() error {
+		var err error
+		resp, err = s.client.CreateChatCompletion(ctx, req)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", errors.New("no summary was returned")
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+// preview returns the first line of message, shortened for display
+func preview(message string) string {
+	message = strings.TrimSpace(message)
+	if i := strings.Index(message, "\n"); i >= 0 {
+		message = message[:i] + "..."
+	}
+	if runes := []rune(message); len(runes) > 80 {
+		message = string(runes[:77]) + "..."
+	}
+	return message
+}
@@ -0,0 +1,115 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	s, fake := newTestSession(t, "Let me check.\n/unknown", "Sorry, I can't do that.")
+
+	response, err := s.Run(context.Background(), "Do something")
+	assert.NoError(t, err)
+	assert.Equal(t, "Sorry, I can't do that.", response)
+
+	requests := fake.Requests()
+	assert.Len(t, requests, 4)
+	assert.Equal(t, openingPrompt, requests[0].Messages[1].Content)
+	assert.Contains(t, requests[1].Messages[3].Content, "Here are the commands you have available")
+	assert.Equal(t, "Do something", requests[2].Messages[5].Content)
+	assert.Contains(t, requests[3].Messages[7].Content, "Unrecognised command: /unknown")
+}
+
+func TestRunTurn(t *testing.T) {
+	ui.SetOutput(io.Discard)
+	fake := provider.NewFake().
+		Fail(&provider.Error{StatusCode: http.StatusBadRequest, Err: assert.AnError}).
+		Respond("/help").
+		Respond("/unknown").
+		Respond("Done")
+	cfg := config.New().WithOpenAIAPIModel("gpt-4").WithMaxAutonomousTurns(1)
+	s := New(cfg, fake, module.NewRegistry())
+	s.AppendMessage(provider.RoleUser, "Help")
+
+	var failures, loops int
+	var responses []string
+	response, err := s.RunTurn(context.Background(), TurnHooks{
+		RequestFailed: func(ctx context.Context, err error) bool {
+			failures++
+			return true
+		},
+		Response: func(response provider.Message, chat string) {
+			responses = append(responses, response.Content)
+		},
+		Loop: func(err *LoopError) bool {
+			loops++
+			return true
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Done", response)
+	assert.Equal(t, 1, failures)
+	assert.Equal(t, 2, loops)
+	assert.Equal(t, []string{"/help", "/unknown", "Done"}, responses)
+}
+
+func TestStreamFailure(t *testing.T) {
+	ui.SetOutput(io.Discard)
+	badGateway := &provider.Error{StatusCode: http.StatusBadGateway, Err: errors.New("bad gateway")}
+	fake := provider.NewFake().
+		Fail(badGateway).
+		FailStream("Hello there", badGateway).
+		Respond("Hello there")
+	cfg := config.New().
+		WithOpenAIAPIModel("gpt-4").
+		WithStreamingMode(true).
+		WithRetryBaseDelay(time.Millisecond)
+	s := New(cfg, fake, module.NewRegistry())
+
+	var chunks []string
+	ctx := WithEvents(context.Background(), func(e Event) {
+		if e.Type == EventChunk {
+			chunks = append(chunks, e.Content)
+		}
+	})
+
+	// a request which fails before anything is streamed is retried, but once
+	// part of the response has been streamed the error is returned instead
+	_, err := s.RequestCompletion(ctx)
+	require.ErrorIs(t, err, badGateway)
+	assert.Len(t, fake.Requests(), 2)
+	assert.Equal(t, []string{"Hello ", "there"}, chunks)
+}
+
+func TestDebugEvents(t *testing.T) {
+	s, _ := newTestSession(t, "Hello!")
+	s.SetConfig(s.Config().WithDebugMode(true))
+
+	// nothing is printed when there's something to send the events to
+	var buf strings.Builder
+	ui.SetOutput(&buf)
+	t.Cleanup(func() { ui.SetOutput(io.Discard) })
+
+	var names []string
+	ctx := WithEvents(context.Background(), func(e Event) {
+		if e.Type == EventDebug {
+			names = append(names, e.Name)
+		}
+	})
+	_, err := s.Run(ctx, "Hi")
+	require.NoError(t, err)
+	assert.Equal(t, []string{ui.System, ui.User, ui.AI, ui.Module, ui.AI, ui.User, ui.AI}, names)
+	assert.Empty(t, buf.String())
+}
@@ -0,0 +1,237 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/secret"
+)
+
+// SavePath is the directory saved conversations are stored in
+var SavePath = "./sessions"
+
+// validName matches the names conversations can be saved as
+var validName = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+var ErrSessionNotFound = errors.New("saved conversation not found")
+
+// saved is the format conversations are saved in
+type saved struct {
+	Name           string             `json:"name"`
+	Saved          time.Time          `json:"saved"`
+	Model          string             `json:"model"`
+	SupervisedMode bool               `json:"supervised_mode"`
+	DebugMode      bool               `json:"debug_mode"`
+	StreamingMode  bool               `json:"streaming_mode"`
+	ToolsMode      bool               `json:"tools_mode"`
+	Messages       []provider.Message `json:"messages"`
+	Transcript     []Entry            `json:"transcript,omitempty"`
+	Branches       []*branch          `json:"branches,omitempty"`
+	Branch         int                `json:"branch,omitempty"`
+}
+
+// Info describes a saved conversation
+type Info struct {
+	Name     string
+	Saved    time.Time
+	Model    string
+	Messages int
+}
+
+// Name returns the name the conversation was last saved or loaded as
+func (s *Session) Name() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.name
+}
+
+// Save saves the conversation, including the model and modes, so it can be loaded later.
+//
+// If name is empty, the name the conversation was last saved or loaded as is
+// used, or if it hasn't been saved before a name is generated from the time.
+func (s *Session) Save(name string) (string, error) {
+	if name == "" {
+		name = s.Name()
+	}
+	if name == "" {
+		name = time.Now().Format("2006-01-02-150405")
+	}
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid name, names can only use letters, numbers, '.', '-' and '_': %s", name)
+	}
+
+	cfg := s.Config()
+	branches, current := s.savedBranches()
+	b, err := json.MarshalIndent(saved{
+		Name:           name,
+		Saved:          time.Now(),
+		Model:          cfg.OpenAIAPIModel(),
+		SupervisedMode: cfg.IsSupervisedMode(),
+		DebugMode:      cfg.IsDebugMode(),
+		StreamingMode:  cfg.IsStreamingMode(),
+		ToolsMode:      cfg.IsToolsMode(),
+		Messages:       s.Messages(),
+		Transcript:     s.Transcript(),
+		Branches:       branches,
+		Branch:         current,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(SavePath, 0700); err != nil {
+		return "", fmt.Errorf("error creating directory: %s", err)
+	}
+	// secrets can be in command output, or anything else in the conversation
+	b = []byte(secret.Redact(string(b)))
+	if err := ioutil.WriteFile(savePath(name), b, 0600); err != nil {
+		return "", fmt.Errorf("error saving conversation: %s", err)
+	}
+
+	s.mu.Lock()
+	s.name = name
+	s.mu.Unlock()
+
+	return name, nil
+}
+
+// savedBranches returns a copy of the branches to save, if there are any,
+// and the ID of the current branch
+func (s *Session) savedBranches() ([]*branch, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.branches) == 0 {
+		return nil, 0
+	}
+
+	s.saveBranch()
+	branches := make([]*branch, len(s.branches))
+	for i, b := range s.branches {
+		c := *b
+		branches[i] = &c
+	}
+	return branches, s.branch
+}
+
+// Load replaces the conversation, model and modes with a saved conversation
+func (s *Session) Load(name string) error {
+	if !validName.MatchString(name) {
+		return ErrSessionNotFound
+	}
+
+	b, err := ioutil.ReadFile(savePath(name))
+	if os.IsNotExist(err) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error loading conversation: %s", err)
+	}
+
+	var conversation saved
+	if err := json.Unmarshal(b, &conversation); err != nil {
+		return fmt.Errorf("error loading conversation: %s", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.name = name
+	s.interval = newInterval()
+	s.guard = loopGuard{}
+	s.outputs = nil
+	s.branches = nil
+	s.branch = 0
+	if conversation.Branch >= 1 && conversation.Branch <= len(conversation.Branches) {
+		s.branches = conversation.Branches
+		s.branch = conversation.Branch
+	}
+	s.messages = conversation.Messages
+	s.transcript = conversation.Transcript
+	if len(s.transcript) == 0 {
+		// the transcript is optional, so build one from the messages
+		for _, message := range conversation.Messages {
+			s.transcript = append(s.transcript, Entry{
+				Kind:       kindOf(message),
+				Role:       message.Role,
+				Content:    message.Content,
+				ToolCalls:  message.ToolCalls,
+				ToolCallID: message.ToolCallID,
+			})
+		}
+	}
+	s.cfg = s.cfg.
+		WithSupervisedMode(conversation.SupervisedMode).
+		WithDebugMode(conversation.DebugMode).
+		WithStreamingMode(conversation.StreamingMode).
+		WithToolsMode(conversation.ToolsMode)
+	if conversation.Model != "" {
+		s.cfg = s.cfg.WithOpenAIAPIModel(conversation.Model)
+	}
+
+	return nil
+}
+
+// List returns the saved conversations, most recently saved first
+func List() ([]Info, error) {
+	entries, err := os.ReadDir(SavePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing saved conversations: %s", err)
+	}
+
+	var conversations []Info
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(SavePath, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error loading conversation: %s", err)
+		}
+		var conversation saved
+		if err := json.Unmarshal(b, &conversation); err != nil {
+			// not every file is necessarily a conversation
+			continue
+		}
+
+		conversations = append(conversations, Info{
+			Name:     strings.TrimSuffix(entry.Name(), ".json"),
+			Saved:    conversation.Saved,
+			Model:    conversation.Model,
+			Messages: len(conversation.Messages),
+		})
+	}
+
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].Saved.After(conversations[j].Saved)
+	})
+	return conversations, nil
+}
+
+// Last returns the name of the most recently saved conversation
+func Last() (string, error) {
+	conversations, err := List()
+	if err != nil {
+		return "", err
+	}
+	if len(conversations) == 0 {
+		return "", ErrSessionNotFound
+	}
+	return conversations[0].Name, nil
+}
+
+func savePath(name string) string {
+	return filepath.Join(SavePath, name+".json")
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	SavePath = t.TempDir()
+
+	cfg := config.New().WithOpenAIAPIModel("gpt-4").WithToolsMode(true)
+	s := New(cfg, nil, module.NewRegistry())
+	s.Start(context.Background())
+	s.AppendMessage(provider.RoleUser, "Hello")
+
+	name, err := s.Save("")
+	require.NoError(t, err)
+	assert.NotEmpty(t, name)
+
+	// saving again uses the same name
+	_, err = s.Save("first")
+	require.NoError(t, err)
+	name, err = s.Save("")
+	require.NoError(t, err)
+	assert.Equal(t, "first", name)
+
+	_, err = s.Save("../escape")
+	assert.Error(t, err)
+
+	loaded := New(config.New().WithOpenAIAPIModel("gpt-3.5-turbo"), nil, module.NewRegistry())
+	require.NoError(t, loaded.Load("first"))
+	assert.Equal(t, "first", loaded.Name())
+	assert.Equal(t, s.Messages(), loaded.Messages())
+	assert.Equal(t, "gpt-4", loaded.Config().OpenAIAPIModel())
+	assert.True(t, loaded.Config().IsToolsMode())
+	assert.True(t, loaded.Config().IsSupervisedMode())
+
+	assert.ErrorIs(t, loaded.Load("missing"), ErrSessionNotFound)
+
+	conversations, err := List()
+	require.NoError(t, err)
+	assert.Len(t, conversations, 2)
+	assert.Equal(t, "first", conversations[0].Name)
+	assert.Equal(t, 2, conversations[0].Messages)
+
+	last, err := Last()
+	require.NoError(t, err)
+	assert.Equal(t, "first", last)
+
+	// resetting starts a new conversation, rather than overwriting the saved one
+	loaded.Reset()
+	assert.Empty(t, loaded.Name())
+}
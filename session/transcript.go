@@ -0,0 +1,125 @@
+package session
+
+import (
+	"time"
+
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/provider"
+)
+
+// kinds of transcript entry, which say where a message came from
+const (
+	// KindSystem is the system prompt
+	KindSystem = "system"
+	// KindApp is a message GPTChat sends on the user's behalf, like the opening prompt
+	KindApp = "app"
+	// KindUser is a message from the user
+	KindUser = "user"
+	// KindAI is a response from GPT
+	KindAI = "ai"
+	// KindInterval is the interval prompt which is occasionally added to the conversation
+	KindInterval = "interval"
+	// KindModule is the result of a slash command
+	KindModule = "module"
+	// KindTool is the result of a tool call
+	KindTool = "tool"
+	// KindSummary replaces messages which no longer fit in the context window
+	KindSummary = "summary"
+)
+
+// Entry is a message in the transcript of a conversation
+type Entry struct {
+	Time       time.Time           `json:"time"`
+	Kind       string              `json:"kind"`
+	Role       string              `json:"role"`
+	Content    string              `json:"content"`
+	ToolCalls  []provider.ToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string              `json:"tool_call_id,omitempty"`
+	// Model is the model which generated a response from GPT
+	Model   string        `json:"model,omitempty"`
+	Command *CommandEntry `json:"command,omitempty"`
+}
+
+// CommandEntry describes the command which produced a module or tool entry
+type CommandEntry struct {
+	Command string `json:"command"`
+	Args    string `json:"args,omitempty"`
+	Body    string `json:"body,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func newCommandEntry(command, args, body string, result *module.CommandResult) *CommandEntry {
+	entry := &CommandEntry{
+		Command: command,
+		Args:    args,
+		Body:    body,
+		Output:  result.Prompt,
+	}
+	if result.Error != nil {
+		entry.Error = result.Error.Error()
+	}
+	return entry
+}
+
+func (e Entry) message() provider.Message {
+	return provider.Message{
+		Role:       e.Role,
+		Content:    e.Content,
+		ToolCalls:  e.ToolCalls,
+		ToolCallID: e.ToolCallID,
+		Model:      e.Model,
+	}
+}
+
+// kindOf returns the kind of entry for a message added without one
+func kindOf(message provider.Message) string {
+	switch message.Role {
+	case provider.RoleUser:
+		return KindUser
+	case provider.RoleAssistant:
+		return KindAI
+	case provider.RoleTool:
+		return KindTool
+	default:
+		return KindSystem
+	}
+}
+
+// Transcript returns a copy of every message in the conversation, including
+// messages which have been evicted from the context window
+func (s *Session) Transcript() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry{}, s.transcript...)
+}
+
+// add adds a message to the conversation and the transcript, and keeps
+// track of the commands GPT has used since the user last responded
+func (s *Session) add(kind string, message provider.Message, command *CommandEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, message)
+	s.record(kind, message, command)
+
+	switch {
+	case kind == KindUser:
+		s.guard = loopGuard{}
+	case command != nil:
+		s.guard.record(commandKey(command.Command, command.Args, command.Body))
+	}
+}
+
+// record adds a message to the transcript, mu must be held
+func (s *Session) record(kind string, message provider.Message, command *CommandEntry) {
+	s.transcript = append(s.transcript, Entry{
+		Time:       time.Now(),
+		Kind:       kind,
+		Role:       message.Role,
+		Content:    message.Content,
+		ToolCalls:  message.ToolCalls,
+		ToolCallID: message.ToolCallID,
+		Model:      message.Model,
+		Command:    command,
+	})
+}
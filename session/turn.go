@@ -0,0 +1,454 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ian-kent/gptchat/config"
+	"github.com/ian-kent/gptchat/module"
+	"github.com/ian-kent/gptchat/parser"
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/retry"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/ian-kent/gptchat/util"
+)
+
+// Run starts the conversation and sends prompt to GPT, executing commands
+// until GPT stops using them, then returns GPT's final response
+func (s *Session) Run(ctx context.Context, prompt string) (string, error) {
+	if s.Start(ctx) {
+		if _, err := s.RunUntilDone(ctx); err != nil {
+			return "", err
+		}
+	}
+
+	return s.Send(ctx, prompt)
+}
+
+// Send adds the user's message to the conversation, and executes commands
+// until GPT stops using them, then returns GPT's final response
+func (s *Session) Send(ctx context.Context, message string) (string, error) {
+	s.AppendMessage(provider.RoleUser, message)
+	if s.Config().IsDebugMode() {
+		debug(ctx, ui.User, message)
+	}
+
+	return s.RunUntilDone(ctx)
+}
+
+// RunUntilDone requests a response from GPT, and executes any commands it
+// uses, until GPT responds without using any commands
+func (s *Session) RunUntilDone(ctx context.Context) (string, error) {
+	return s.RunTurn(ctx, TurnHooks{})
+}
+
+// TurnHooks change how a turn is taken, any of them can be nil
+type TurnHooks struct {
+	// BeforeRequest is called before each request to GPT
+	BeforeRequest func()
+	// Request asks GPT to respond to the conversation, instead of
+	// RequestCompletion, for example to let the user choose between candidates
+	Request func(ctx context.Context) (provider.Message, error)
+	// RequestFailed is called if a request fails, and returns true to try
+	// again. Otherwise the error is returned.
+	RequestFailed func(ctx context.Context, err error) bool
+	// Response is called with each response once it's been added to the
+	// conversation, along with the part of it which is meant for the user
+	Response func(response provider.Message, chat string)
+	// Loop is called if GPT looks like it's stuck, and returns true to let it
+	// carry on. Otherwise the *LoopError is returned.
+	Loop func(err *LoopError) bool
+}
+
+// RunTurn requests a response from GPT, and executes any commands it uses,
+// until GPT responds without using any commands. It returns the part of the
+// final response which is meant for the user.
+func (s *Session) RunTurn(ctx context.Context, hooks TurnHooks) (string, error) {
+	request := s.RequestCompletion
+	if hooks.Request != nil {
+		request = hooks.Request
+	}
+
+	for {
+		if hooks.BeforeRequest != nil {
+			hooks.BeforeRequest()
+		}
+		if interval, ok := s.AddIntervalPromptIfDue(); ok && s.Config().IsDebugMode() {
+			debug(ctx, ui.System, interval)
+		}
+		s.Fit(ctx)
+
+		response, err := request(ctx)
+		for err != nil {
+			if hooks.RequestFailed == nil || !hooks.RequestFailed(ctx, err) {
+				return "", err
+			}
+			response, err = request(ctx)
+		}
+
+		s.AddMessage(response)
+		// a streamed response has already been shown in full in debug mode
+		if cfg := s.Config(); cfg.IsDebugMode() && !cfg.IsStreamingMode() && response.Content != "" {
+			debug(ctx, ui.AI, response.Content)
+		}
+		chat := s.ResponseChat(response)
+		if chat != "" {
+			emit(ctx, Event{Type: EventMessage, Content: chat, Model: response.Model})
+		}
+		if hooks.Response != nil {
+			hooks.Response(response, chat)
+		}
+
+		executed := s.ExecuteCommands(ctx, response)
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if !executed {
+			return chat, nil
+		}
+
+		var loopErr *LoopError
+		if err := s.CheckLoop(); errors.As(err, &loopErr) {
+			if hooks.Loop == nil || !hooks.Loop(loopErr) {
+				return "", err
+			}
+			s.ResetLoop()
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// RequestCompletion asks GPT to respond to the conversation, retrying using the configured policy
+func (s *Session) RequestCompletion(ctx context.Context) (provider.Message, error) {
+	cfg := s.Config()
+	ctx = s.withUsage(ctx, "chat")
+
+	var response provider.Message
+	err := s.retryPolicy(ctx, cfg).Do(ctx, func() error {
+		var err error
+		response, err = s.createChatCompletion(ctx, cfg)
+		return err
+	})
+	return response, err
+}
+
+// retryPolicy returns the configured retry policy, which reports each retry
+// using an event, or prints it if there isn't anything to send events to
+func (s *Session) retryPolicy(ctx context.Context, cfg config.Config) retry.Policy {
+	policy := retry.FromConfig(cfg)
+	policy.OnRetry = func(err error, attempt int, delay time.Duration) {
+		message := fmt.Sprintf("request failed, trying again in %s", delay.Round(time.Millisecond))
+		if !hasEvents(ctx) {
+			ui.Error(message, err)
+			return
+		}
+		emit(ctx, Event{Type: EventRetry, Content: message, Error: err.Error()})
+	}
+	return policy
+}
+
+// RequestCandidates asks GPT for n different responses to the conversation, so
+// the user can choose which one to keep. The responses are never streamed.
+func (s *Session) RequestCandidates(ctx context.Context, n int) ([]provider.Message, error) {
+	cfg := s.Config()
+	ctx = s.withUsage(ctx, "chat")
+
+	req := s.chatRequest(cfg)
+	req.N = n
+
+	var candidates []provider.Message
+	err := s.retryPolicy(ctx, cfg).Do(ctx, func() error {
+		resp, err := s.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return err
+		}
+		if len(resp.Choices) == 0 {
+			return errors.New("no choices were returned")
+		}
+		candidates = nil
+		for _, choice := range resp.Choices {
+			choice.Message.Model = resp.Model
+			candidates = append(candidates, choice.Message)
+		}
+		return nil
+	})
+	return candidates, err
+}
+
+// ResponseChat returns the part of a response which is meant for the user
+func (s *Session) ResponseChat(response provider.Message) string {
+	if s.Config().IsToolsMode() {
+		return strings.TrimSpace(response.Content)
+	}
+	return parser.Parse(response.Content).Chat
+}
+
+// ExecuteCommands executes the commands or tool calls in a response and adds the
+// results to the conversation. It returns true if any commands were executed,
+// in which case GPT is waiting for us to send it the results.
+func (s *Session) ExecuteCommands(ctx context.Context, response provider.Message) bool {
+	cfg := s.Config()
+	ctx = module.WithConfig(ctx, cfg)
+
+	var executed bool
+
+	if cfg.IsToolsMode() {
+		results := make([]*module.CommandResult, len(response.ToolCalls))
+		jobs := make([]job, len(response.ToolCalls))
+		for i, toolCall := range response.ToolCalls {
+			i, toolCall := i, toolCall
+			jobs[i] = job{
+				serial: s.modules.IsSerialToolCall(toolCall),
+				run: func() {
+					// every tool call needs a result, even if it's been cancelled
+					results[i] = &module.CommandResult{Error: errCancelled}
+					if ctx.Err() != nil {
+						return
+					}
+					emit(ctx, Event{Type: EventCommand, Command: "/" + toolCall.Name, Args: toolCall.Arguments})
+					results[i] = s.executeToolCall(s.withUsage(ctx, "/"+toolCall.Name), toolCall)
+					emitCommandResult(ctx, "/"+toolCall.Name, results[i])
+				},
+			}
+		}
+		runJobs(cfg.ConcurrentCommands(), jobs)
+
+		// the results are added in the same order GPT used the tools
+		for i, toolCall := range response.ToolCalls {
+			executed = true
+
+			message := provider.Message{
+				Role:       provider.RoleTool,
+				Content:    toolResult(results[i]),
+				ToolCallID: toolCall.ID,
+			}
+			s.add(KindTool, message, newCommandEntry("/"+toolCall.Name, toolCall.Arguments, "", results[i]))
+
+			if cfg.IsDebugMode() {
+				debug(ctx, ui.Tool, fmt.Sprintf("%s %s\n\n%s", toolCall.Name, toolCall.Arguments, message.Content))
+			}
+		}
+		return executed
+	}
+
+	commands := parser.Parse(response.Content).Commands
+	results := make([]*module.CommandResult, len(commands))
+	jobs := make([]job, len(commands))
+	for i, command := range commands {
+		i, command := i, command
+		jobs[i] = job{
+			serial: s.modules.IsSerial(command.Command, command.Args),
+			run: func() {
+				// commands which haven't started by the time we're cancelled are skipped
+				if ctx.Err() != nil {
+					return
+				}
+				emit(ctx, Event{Type: EventCommand, Command: command.Command, Args: command.Args, Body: command.Body})
+				ok, result := s.executeCommand(s.withUsage(ctx, command.Command), command.Command, command.Args, command.Body)
+				if !ok {
+					return
+				}
+				results[i] = result
+				emitCommandResult(ctx, command.Command, result)
+			},
+		}
+	}
+	runJobs(cfg.ConcurrentCommands(), jobs)
+
+	// the results are added in the same order GPT used the commands
+	for i, command := range commands {
+		result := results[i]
+		if result == nil {
+			continue
+		}
+		executed = true
+
+		msg := commandResult(command, result)
+		s.add(KindModule, provider.Message{Role: provider.RoleSystem, Content: msg}, newCommandEntry(command.Command, command.Args, command.Body, result))
+		if cfg.IsDebugMode() {
+			debug(ctx, ui.Module, msg)
+		}
+	}
+
+	return executed
+}
+
+var errCancelled = errors.New("the command was cancelled by the user")
+
+func emitCommandResult(ctx context.Context, command string, result *module.CommandResult) {
+	e := Event{Type: EventCommandResult, Command: command, Content: result.Prompt}
+	if result.Error != nil {
+		e.Error = result.Error.Error()
+	}
+	emit(ctx, e)
+}
+
+// commandResult returns the message which gives GPT the result of a slash command
+func commandResult(command parser.ParseCommand, result *module.CommandResult) string {
+	if result.Error != nil {
+		msg := fmt.Sprintf(`An error occurred executing your command.
+
+The command was:
+`+util.TripleQuote+`
+%s
+`+util.TripleQuote+`
+
+The error was:
+`+util.TripleQuote+`
+%s
+`+util.TripleQuote, command.String(), result.Error.Error())
+
+		if result.Prompt != "" {
+			msg += fmt.Sprintf(`
+
+The command provided this additional output:
+`+util.TripleQuote+`
+%s
+`+util.TripleQuote, result.Prompt)
+		}
+
+		return msg
+	}
+
+	return fmt.Sprintf(`Your command returned some output.
+
+The command was:
+`+util.TripleQuote+`
+%s
+`+util.TripleQuote+`
+
+The output was:
+
+%s`, command.String(), result.Prompt)
+}
+
+// chatRequest returns a request for GPT to respond to the conversation
+func (s *Session) chatRequest(cfg config.Config) provider.ChatRequest {
+	req := provider.ChatRequest{
+		Model:    cfg.OpenAIAPIModel(),
+		Messages: s.Messages(),
+		Sampling: cfg.Sampling(),
+	}
+	if cfg.IsToolsMode() {
+		req.Tools = s.modules.Tools()
+		if cfg.IsOutputPaging() {
+			req.Tools = append(req.Tools, outputTool)
+		}
+	}
+	return req
+}
+
+func (s *Session) createChatCompletion(ctx context.Context, cfg config.Config) (provider.Message, error) {
+	req := s.chatRequest(cfg)
+
+	if !cfg.IsStreamingMode() {
+		resp, err := s.client.CreateChatCompletion(ctx, req)
+		if err != nil {
+			return provider.Message{}, err
+		}
+		if len(resp.Choices) == 0 {
+			return provider.Message{}, errors.New("no choices were returned")
+		}
+		message := resp.Choices[0].Message
+		message.Model = resp.Model
+		return message, nil
+	}
+
+	stream, err := s.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return provider.Message{}, err
+	}
+	defer stream.Close()
+
+	var output Stream = eventStream{ctx}
+	if newStream, ok := ctx.Value(streamKey{}).(func() Stream); ok {
+		output = newStream()
+	} else if !hasEvents(ctx) {
+		// in debug mode we print the full response, otherwise we hide
+		// the commands in the same way we would for a parsed response
+		output = ui.NewChatStream(ui.AI, !cfg.IsDebugMode() && !cfg.IsToolsMode())
+	}
+	defer output.End()
+
+	var content strings.Builder
+	var toolCalls []provider.ToolCall
+	var model string
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// retrying would show the response again after the part the
+			// user has already seen, so let them decide what to do
+			if content.Len() > 0 {
+				return provider.Message{}, retry.Stop(err)
+			}
+			return provider.Message{}, err
+		}
+		if model == "" {
+			model = chunk.Model
+		}
+		content.WriteString(chunk.Content)
+		output.Write(chunk.Content)
+		toolCalls = provider.AppendToolCallDeltas(toolCalls, chunk.ToolCalls)
+	}
+
+	return provider.Message{
+		Role:      provider.RoleAssistant,
+		Content:   content.String(),
+		ToolCalls: toolCalls,
+		Model:     model,
+	}, nil
+}
+
+// Stream displays a response as it's streamed
+type Stream interface {
+	Write(chunk string)
+	// End is called once the response is complete
+	End()
+}
+
+type streamKey struct{}
+
+// WithStream returns a context which displays streamed responses using the
+// stream returned by newStream, rather than printing them to the terminal
+func WithStream(ctx context.Context, newStream func() Stream) context.Context {
+	return context.WithValue(ctx, streamKey{}, newStream)
+}
+
+// eventStream sends a streamed response as chunk events
+type eventStream struct {
+	ctx context.Context
+}
+
+func (e eventStream) Write(chunk string) {
+	if chunk != "" {
+		emit(e.ctx, Event{Type: EventChunk, Content: chunk})
+	}
+}
+
+func (e eventStream) End() {}
+
+// toolResult returns the content of the tool message for a command result
+func toolResult(result *module.CommandResult) string {
+	if result.Error == nil {
+		return result.Prompt
+	}
+
+	msg := fmt.Sprintf("An error occurred executing your command: %s", result.Error)
+	if result.Prompt != "" {
+		msg += fmt.Sprintf(`
+
+The command provided this additional output:
+`+util.TripleQuote+`
+%s
+`+util.TripleQuote, result.Prompt)
+	}
+	return msg
+}
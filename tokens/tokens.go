@@ -0,0 +1,151 @@
+// Package tokens estimates token usage and manages the context window
+package tokens
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ian-kent/gptchat/provider"
+)
+
+// ResponseReserve is the number of tokens left free in the context window for the response
+const ResponseReserve = 1024
+
+// messageOverhead is the number of tokens used by each message in addition to its content
+const messageOverhead = 4
+
+// replyOverhead is the number of tokens used to prime the reply
+const replyOverhead = 3
+
+// contextWindows is ordered so more specific model names are matched first
+var contextWindows = []struct {
+	prefix string
+	size   int
+}{
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4-1106", 128000},
+	{"gpt-4-0125", 128000},
+	{"gpt-4-32k", 32768},
+	{"gpt-4", 8192},
+	{"gpt-3.5-turbo-16k", 16384},
+	{"gpt-3.5-turbo", 4096},
+}
+
+const defaultContextWindow = 4096
+
+// Count estimates the number of tokens in text.
+//
+// It doesn't use a real tokenizer, but roughly four characters per token
+// is close enough for English text to manage the context window.
+func Count(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// CountMessages estimates the number of tokens used by a request containing messages
+func CountMessages(messages []provider.Message) int {
+	total := replyOverhead
+	for _, message := range messages {
+		total += CountMessage(message)
+	}
+	return total
+}
+
+// CountMessage estimates the number of tokens used by a single message
+func CountMessage(message provider.Message) int {
+	total := messageOverhead + Count(message.Role) + Count(message.Content)
+	for _, toolCall := range message.ToolCalls {
+		total += Count(toolCall.ID) + Count(toolCall.Name) + Count(toolCall.Arguments)
+	}
+	return total
+}
+
+// ContextWindow returns the size of the context window for model
+func ContextWindow(model string) int {
+	model = strings.ToLower(model)
+	for _, window := range contextWindows {
+		if strings.HasPrefix(model, window.prefix) {
+			return window.size
+		}
+	}
+	return defaultContextWindow
+}
+
+// Budget returns the number of tokens available for messages sent to model
+func Budget(model string) int {
+	return ContextWindow(model) - ResponseReserve
+}
+
+// Fit evicts the oldest messages until messages fits within budget.
+//
+// The first message (the system prompt) is always kept, along with the most
+// recent assistant message and anything after it, such as command results or
+// the latest user input. The latest user input is kept even if GPT has
+// responded to it, so it isn't forgotten while GPT is using commands.
+// Messages are evicted in whole turns, so a command or tool result is never
+// kept without the message which requested it.
+//
+// If the pinned messages don't fit within budget, they're returned anyway.
+func Fit(messages []provider.Message, budget int) (kept, evicted []provider.Message) {
+	if CountMessages(messages) <= budget || len(messages) < 2 {
+		return messages, nil
+	}
+
+	pinnedFrom := len(messages)
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == provider.RoleAssistant {
+			pinnedFrom = i
+			break
+		}
+	}
+	if pinnedFrom == len(messages) {
+		// there's no assistant message, so keep the latest user input
+		for i := len(messages) - 1; i > 0; i-- {
+			if messages[i].Role == provider.RoleUser {
+				pinnedFrom = i
+				break
+			}
+		}
+	}
+
+	latestUser := 0
+	for i := len(messages) - 1; i > 0; i-- {
+		if messages[i].Role == provider.RoleUser {
+			latestUser = i
+			break
+		}
+	}
+
+	total := CountMessages(messages)
+	evictTo := 1
+	var keepUser bool
+	for evictTo < pinnedFrom && total > budget {
+		if evictTo == latestUser {
+			keepUser = true
+			evictTo++
+			continue
+		}
+
+		// evict a whole turn, which is a user or assistant message
+		// along with any system or tool messages which follow it
+		end := evictTo + 1
+		for end < pinnedFrom && (messages[end].Role == provider.RoleSystem || messages[end].Role == provider.RoleTool) {
+			end++
+		}
+		for _, message := range messages[evictTo:end] {
+			total -= CountMessage(message)
+		}
+		evictTo = end
+	}
+
+	kept = append(kept, messages[0])
+	if keepUser {
+		kept = append(kept, messages[latestUser])
+		evicted = append(evicted, messages[1:latestUser]...)
+		evicted = append(evicted, messages[latestUser+1:evictTo]...)
+	} else {
+		evicted = append(evicted, messages[1:evictTo]...)
+	}
+	kept = append(kept, messages[evictTo:]...)
+	return kept, evicted
+}
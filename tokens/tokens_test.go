@@ -0,0 +1,63 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextWindow(t *testing.T) {
+	assert.Equal(t, 8192, ContextWindow("gpt-4"))
+	assert.Equal(t, 32768, ContextWindow("gpt-4-32k-0613"))
+	assert.Equal(t, 128000, ContextWindow("gpt-4o-mini"))
+	assert.Equal(t, 4096, ContextWindow("gpt-3.5-turbo"))
+	assert.Equal(t, 16384, ContextWindow("gpt-3.5-turbo-16k"))
+	assert.Equal(t, defaultContextWindow, ContextWindow("llama"))
+}
+
+func TestFit(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	system := provider.Message{Role: provider.RoleSystem, Content: "system prompt"}
+	messages := []provider.Message{
+		system,
+		{Role: provider.RoleUser, Content: long},
+		{Role: provider.RoleAssistant, Content: "/memory recall {}"},
+		{Role: provider.RoleSystem, Content: long},
+		{Role: provider.RoleAssistant, Content: long},
+		{Role: provider.RoleUser, Content: "hello"},
+		{Role: provider.RoleAssistant, Content: "/help"},
+		{Role: provider.RoleSystem, Content: long},
+	}
+
+	kept, evicted := Fit(messages, CountMessages(messages))
+	assert.Equal(t, messages, kept)
+	assert.Empty(t, evicted)
+
+	// only room for the pinned messages and the latest user input
+	budget := CountMessages([]provider.Message{system, messages[5], messages[6], messages[7]})
+	kept, evicted = Fit(messages, budget)
+	assert.Equal(t, append([]provider.Message{system}, messages[5:]...), kept)
+	assert.Equal(t, messages[1:5], evicted)
+
+	// the command result stays with the message which requested it
+	budget = CountMessages([]provider.Message{system, messages[4], messages[5], messages[6], messages[7]})
+	kept, evicted = Fit(messages, budget)
+	assert.Equal(t, append([]provider.Message{system}, messages[4:]...), kept)
+	assert.Equal(t, messages[1:4], evicted)
+
+	// pinned messages, including the latest user input, are kept even if they don't fit
+	kept, evicted = Fit(messages, 1)
+	assert.Equal(t, []provider.Message{system, messages[5], messages[6], messages[7]}, kept)
+	assert.Equal(t, messages[1:5], evicted)
+
+	// the latest user input is kept while GPT is using commands
+	loop := append(append([]provider.Message{}, messages...),
+		provider.Message{Role: provider.RoleAssistant, Content: "/help"},
+		provider.Message{Role: provider.RoleSystem, Content: long},
+	)
+	kept, evicted = Fit(loop, 1)
+	assert.Equal(t, []provider.Message{system, loop[5], loop[8], loop[9]}, kept)
+	assert.Equal(t, append(append([]provider.Message{}, loop[1:5]...), loop[6:8]...), evicted)
+}
@@ -1,16 +1,16 @@
 package ui
 
 import (
-	"os"
 	"strings"
 
 	"github.com/fatih/color"
 )
 
-var theme Theme
+var theme = LightTheme
 
-func init() {
-	if strings.ToUpper(os.Getenv("GPTCHAT_THEME")) == "DARK" {
+// SetTheme sets the theme by name, anything other than dark uses the light theme
+func SetTheme(name string) {
+	if strings.ToLower(name) == "dark" {
 		theme = DarkTheme
 	} else {
 		theme = LightTheme
@@ -3,8 +3,13 @@ package ui
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+
+	"github.com/fatih/color"
+	"github.com/ian-kent/gptchat/secret"
+	"golang.org/x/term"
 )
 
 const (
@@ -17,42 +22,57 @@ const (
 	App    = "APP"
 )
 
+// output is where everything is printed, which is stdout by default.
+// Secrets are always redacted from it.
+var output = secret.NewWriter(color.Output)
+
+// SetOutput changes where everything is printed, for example to keep
+// stdout clear for the response when running non-interactively
+func SetOutput(w io.Writer) {
+	output = secret.NewWriter(w)
+}
+
+// Println prints a plain line of text
+func Println(a ...any) {
+	fmt.Fprintln(output, a...)
+}
+
 func Error(message string, err error) {
-	theme.Error.Printf("ERROR: ")
-	theme.Useful.Printf("%s: %v\n\n", message, err)
+	theme.Error.Fprintf(output, "ERROR: ")
+	theme.Useful.Fprintf(output, "%s: %v\n\n", message, err)
 }
 
 func Warn(message string) {
-	theme.Warn.Printf("WARNING: ")
-	theme.Useful.Printf("%s\n", message)
+	theme.Warn.Fprintf(output, "WARNING: ")
+	theme.Useful.Fprintf(output, "%s\n", message)
 }
 
 func Info(message string) {
-	theme.Warn.Printf("INFO: ")
-	theme.Useful.Printf("%s\n", message)
+	theme.Warn.Fprintf(output, "INFO: ")
+	theme.Useful.Fprintf(output, "%s\n", message)
 }
 
 func Welcome(title, message string) {
-	theme.AppBold.Printf("%s\n\n", title)
-	theme.App.Printf("%s\n\n", message)
+	theme.AppBold.Fprintf(output, "%s\n\n", title)
+	theme.App.Fprintf(output, "%s\n\n", message)
 }
 
 func PrintChatDebug(name, message string) {
-	theme.Useful.Printf("[DEBUG] ")
+	theme.Useful.Fprintf(output, "[DEBUG] ")
 	PrintChat(name, message)
 }
 
 func PrintChat(name, message string) {
 	switch name {
 	case User:
-		theme.User.Printf("%s:\n\n", name)
-		theme.Message.Printf("%s\n", indent(message))
+		theme.User.Fprintf(output, "%s:\n\n", name)
+		theme.Message.Fprintf(output, "%s\n", indent(message))
 	case AI:
-		theme.AI.Printf("%s:\n\n", name)
-		theme.Useful.Printf("%s\n", indent(message))
+		theme.AI.Fprintf(output, "%s:\n\n", name)
+		theme.Useful.Fprintf(output, "%s\n", indent(message))
 	case App:
-		theme.AppBold.Printf("%s:\n\n", name)
-		theme.Useful.Printf("%s\n", indent(message))
+		theme.AppBold.Fprintf(output, "%s:\n\n", name)
+		theme.Useful.Fprintf(output, "%s\n", indent(message))
 	case System:
 		fallthrough
 	case Tool:
@@ -62,44 +82,233 @@ func PrintChat(name, message string) {
 	case Module:
 		fallthrough
 	default:
-		theme.Username.Printf("%s:\n\n", name)
-		theme.Message.Printf("%s\n", indent(message))
+		theme.Username.Fprintf(output, "%s:\n\n", name)
+		theme.Message.Fprintf(output, "%s\n", indent(message))
+	}
+}
+
+// ChatStream prints a chat message incrementally as it's received
+type ChatStream struct {
+	name         string
+	hideCommands bool
+
+	started     bool
+	atLineStart bool
+
+	// state is where the stream is in the message, and returnTo is where
+	// it goes back to at the end of a command body
+	state    streamState
+	returnTo streamState
+	// nesting is how many braces are open
+	nesting int
+	// newlines is the number of newlines at the end of the printed text,
+	// and pending is the number held back after a command
+	newlines int
+	pending  int
+
+	// a secret can be split between chunks
+	redact secret.Stream
+}
+
+type streamState int
+
+const (
+	streamText streamState = iota
+	// streamCommand is the line a slash command is on
+	streamCommand
+	// streamBody is the body of a command, between braces
+	streamBody
+	// streamAfterCommand is after a command, where its body can still follow
+	streamAfterCommand
+)
+
+// NewChatStream returns a ChatStream for the named participant.
+//
+// If hideCommands is true, slash commands and their bodies aren't printed,
+// matching the chat output returned by the parser.
+func NewChatStream(name string, hideCommands bool) *ChatStream {
+	return &ChatStream{
+		name:         name,
+		hideCommands: hideCommands,
+		atLineStart:  true,
+	}
+}
+
+func (s *ChatStream) Write(chunk string) {
+	s.write(s.redact.Write(chunk))
+}
+
+func (s *ChatStream) write(chunk string) {
+	var text string
+	for _, c := range chunk {
+		switch s.state {
+		case streamCommand:
+			if c == '{' {
+				s.startBody()
+			} else if c == '\n' {
+				s.state = streamAfterCommand
+			}
+			continue
+		case streamBody:
+			if c == '{' {
+				s.nesting++
+			} else if c == '}' {
+				s.nesting--
+				if s.nesting == 0 {
+					s.state = s.returnTo
+				}
+			}
+			continue
+		case streamAfterCommand:
+			switch c {
+			case '\n':
+				s.pending++
+				continue
+			case '{':
+				s.pending = 0
+				s.startBody()
+				continue
+			case '/':
+				s.pending = 0
+				s.state = streamCommand
+				continue
+			}
+
+			// the message carries on after the command, with at most one
+			// blank line in between, like the parser
+			s.state = streamText
+			for ; s.started && s.pending > 0 && s.newlines < 2; s.pending-- {
+				text += "\n"
+				s.newlines++
+			}
+			s.pending = 0
+		}
+
+		if s.atLineStart {
+			// don't print any leading blank lines
+			if !s.started && (c == '\n' || c == ' ') {
+				continue
+			}
+			// a slash inside braces doesn't start a command
+			if s.hideCommands && c == '/' && s.nesting == 0 {
+				s.state = streamCommand
+				continue
+			}
+			if !s.started {
+				s.start()
+			}
+			text += "    "
+			s.atLineStart = false
+		}
+
+		text += string(c)
+		switch c {
+		case '\n':
+			s.atLineStart = true
+			s.newlines++
+			continue
+		case '{':
+			s.nesting++
+		case '}':
+			if s.nesting > 0 {
+				s.nesting--
+			}
+		}
+		s.newlines = 0
+	}
+
+	if text != "" {
+		s.print(text)
+	}
+}
+
+func (s *ChatStream) startBody() {
+	s.returnTo = s.state
+	s.state = streamBody
+	s.nesting = 1
+}
+
+// End finishes the message, it must be called once the stream is complete
+func (s *ChatStream) End() {
+	s.write(s.redact.Flush())
+	if !s.started {
+		return
+	}
+	if !s.atLineStart {
+		fmt.Fprintln(output)
+	}
+	fmt.Fprintln(output)
+}
+
+func (s *ChatStream) start() {
+	s.started = true
+	switch s.name {
+	case User:
+		theme.User.Fprintf(output, "%s:\n\n", s.name)
+	case AI:
+		theme.AI.Fprintf(output, "%s:\n\n", s.name)
+	case App:
+		theme.AppBold.Fprintf(output, "%s:\n\n", s.name)
+	default:
+		theme.Username.Fprintf(output, "%s:\n\n", s.name)
+	}
+}
+
+func (s *ChatStream) print(text string) {
+	switch s.name {
+	case AI, App:
+		theme.Useful.Fprint(output, text)
+	default:
+		theme.Message.Fprint(output, text)
 	}
 }
 
 func PromptChatInput() string {
 	reader := bufio.NewReader(os.Stdin)
-	theme.User.Printf("USER:\n\n    ")
+	theme.User.Fprintf(output, "USER:\n\n    ")
 	text, _ := reader.ReadString('\n')
 	text = strings.TrimSpace(text)
-	fmt.Println()
+	fmt.Fprintln(output)
 
 	return text
 }
 
 func PromptConfirm(prompt string) bool {
 	reader := bufio.NewReader(os.Stdin)
-	theme.AppBold.Printf("%s [Y/N]: ", prompt)
+	theme.AppBold.Fprintf(output, "%s [Y/N]: ", prompt)
 	text, _ := reader.ReadString('\n')
 	text = strings.TrimSpace(text)
-	fmt.Println()
+	fmt.Fprintln(output)
 
 	return strings.ToUpper(text) == "Y"
 }
 
 func PromptInput(prompt string) string {
 	reader := bufio.NewReader(os.Stdin)
-	theme.AppBold.Printf("%s ", prompt)
+	theme.AppBold.Fprintf(output, "%s ", prompt)
 	text, _ := reader.ReadString('\n')
 	text = strings.TrimSpace(text)
 	return text
 }
 
+// PromptSecret prompts for input without echoing it, unless stdin isn't a terminal
+func PromptSecret(prompt string) string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return PromptInput(prompt)
+	}
+
+	theme.AppBold.Fprintf(output, "%s ", prompt)
+	b, _ := term.ReadPassword(fd)
+	fmt.Fprintln(output)
+	return strings.TrimSpace(string(b))
+}
+
 func indent(input string) string {
 	lines := strings.Split(string(input), "\n")
-	var output string
+	var result string
 	for _, line := range lines {
-		output += "    " + line + "\n"
+		result += "    " + line + "\n"
 	}
-	return output
+	return result
 }
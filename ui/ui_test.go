@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatStream(t *testing.T) {
+	noColor := color.NoColor
+	color.NoColor = true
+	t.Cleanup(func() {
+		color.NoColor = noColor
+		SetOutput(color.Output)
+	})
+
+	testCases := []struct {
+		name         string
+		chunks       []string
+		hideCommands bool
+		expected     string
+	}{
+		{
+			name:     "text",
+			chunks:   []string{"Hello,\nworld"},
+			expected: "AI:\n\n    Hello,\n    world\n\n",
+		},
+		{
+			name:     "leading blank lines",
+			chunks:   []string{"\n\n  ", "\nHello"},
+			expected: "AI:\n\n    Hello\n\n",
+		},
+		{
+			name:     "commands shown",
+			chunks:   []string{"Hello\n/memory.recall cats\n"},
+			expected: "AI:\n\n    Hello\n    /memory.recall cats\n\n",
+		},
+		{
+			name:         "text, command, text",
+			chunks:       []string{"Let me check.\n/memory.recall cats\nI'll get back to you."},
+			hideCommands: true,
+			expected:     "AI:\n\n    Let me check.\n    I'll get back to you.\n\n",
+		},
+		{
+			name:         "command with a body",
+			chunks:       []string{"Saving that.\n/memory.store {\n  \"memory\": \"likes cats\"\n}\n\nDone!"},
+			hideCommands: true,
+			expected:     "AI:\n\n    Saving that.\n\n    Done!\n\n",
+		},
+		{
+			name:         "body on the next line",
+			chunks:       []string{"/plugins.create\n{\n  /* a comment */\n}\nDone!"},
+			hideCommands: true,
+			expected:     "AI:\n\n    Done!\n\n",
+		},
+		{
+			name:         "only commands",
+			chunks:       []string{"\n/memory.recall cats\n/memory.recall dogs\n"},
+			hideCommands: true,
+			expected:     "",
+		},
+		{
+			name:         "chunks which split lines",
+			chunks:       []string{"Let me", " check.\n", "/memory", ".recall c", "ats\n", "\n", "I'll get", " back to you."},
+			hideCommands: true,
+			expected:     "AI:\n\n    Let me check.\n\n    I'll get back to you.\n\n",
+		},
+		{
+			name:         "slash inside braces",
+			chunks:       []string{"Here's some JSON: {\n/path\n}\nDone!"},
+			hideCommands: true,
+			expected:     "AI:\n\n    Here's some JSON: {\n    /path\n    }\n    Done!\n\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			SetOutput(&buf)
+
+			stream := NewChatStream(AI, testCase.hideCommands)
+			for _, chunk := range testCase.chunks {
+				stream.Write(chunk)
+			}
+			stream.End()
+			assert.Equal(t, testCase.expected, buf.String())
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/tokens"
+)
+
+// Provider records the usage of every request made using the wrapped provider.
+//
+// Usage is recorded in the lifetime tracker, and in the tracker from the
+// request context if it has one, which is also used to enforce its limit.
+type Provider struct {
+	provider provider.Provider
+	lifetime *Tracker
+}
+
+func NewProvider(p provider.Provider, lifetime *Tracker) *Provider {
+	return &Provider{
+		provider: p,
+		lifetime: lifetime,
+	}
+}
+
+func (p *Provider) CreateChatCompletion(ctx context.Context, req provider.ChatRequest) (provider.ChatResponse, error) {
+	if err := check(ctx); err != nil {
+		return provider.ChatResponse{}, err
+	}
+
+	resp, err := p.provider.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	usage := resp.Usage
+	if usage == (provider.Usage{}) {
+		// not every API reports usage, so we'll have to estimate it
+		usage.PromptTokens = tokens.CountMessages(req.Messages)
+		for _, choice := range resp.Choices {
+			usage.CompletionTokens += tokens.CountMessage(choice.Message)
+		}
+	}
+	p.record(ctx, model(resp.Model, req.Model), usage)
+
+	return resp, nil
+}
+
+func (p *Provider) CreateChatCompletionStream(ctx context.Context, req provider.ChatRequest) (provider.ChatStream, error) {
+	if err := check(ctx); err != nil {
+		return nil, err
+	}
+
+	stream, err := p.provider.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chatStream{
+		stream:   stream,
+		provider: p,
+		ctx:      ctx,
+		req:      req,
+	}, nil
+}
+
+func (p *Provider) CreateEmbeddings(ctx context.Context, req provider.EmbeddingRequest) (provider.EmbeddingResponse, error) {
+	if err := check(ctx); err != nil {
+		return provider.EmbeddingResponse{}, err
+	}
+
+	resp, err := p.provider.CreateEmbeddings(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	usage := resp.Usage
+	if usage == (provider.Usage{}) {
+		for _, input := range req.Input {
+			usage.PromptTokens += tokens.Count(input)
+		}
+	}
+	p.record(ctx, req.Model, usage)
+
+	return resp, nil
+}
+
+func check(ctx context.Context) error {
+	if tracker := trackerFromContext(ctx); tracker != nil {
+		return tracker.Check()
+	}
+	return nil
+}
+
+func (p *Provider) record(ctx context.Context, model string, usage provider.Usage) {
+	source := sourceFromContext(ctx)
+
+	if p.lifetime != nil {
+		if _, err := p.lifetime.Record(source, model, usage); err != nil {
+			warning(ctx, err.Error())
+		}
+	}
+
+	tracker := trackerFromContext(ctx)
+	if tracker == nil {
+		return
+	}
+	warn, err := tracker.Record(source, model, usage)
+	if err != nil {
+		warning(ctx, err.Error())
+	}
+	if warn {
+		warning(ctx, fmt.Sprintf("This session has cost more than $%.2f, use /usage to see where it's gone", tracker.WarnLimit()))
+	}
+}
+
+// model returns the model which generated a response, falling back to the requested model
+func model(responseModel, requestModel string) string {
+	if responseModel != "" {
+		return responseModel
+	}
+	return requestModel
+}
+
+// chatStream records usage once the stream is complete
+type chatStream struct {
+	stream   provider.ChatStream
+	provider *Provider
+	ctx      context.Context
+	req      provider.ChatRequest
+
+	model     string
+	usage     *provider.Usage
+	content   strings.Builder
+	toolCalls []provider.ToolCall
+	recorded  bool
+}
+
+func (s *chatStream) Recv() (provider.ChatStreamChunk, error) {
+	chunk, err := s.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		s.record()
+		return chunk, err
+	}
+	if err != nil {
+		return chunk, err
+	}
+
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	if chunk.Usage != nil {
+		s.usage = chunk.Usage
+	}
+	s.content.WriteString(chunk.Content)
+	s.toolCalls = provider.AppendToolCallDeltas(s.toolCalls, chunk.ToolCalls)
+
+	return chunk, nil
+}
+
+func (s *chatStream) Close() error {
+	// a stream which is closed early has still used tokens
+	s.record()
+	return s.stream.Close()
+}
+
+func (s *chatStream) record() {
+	if s.recorded {
+		return
+	}
+	s.recorded = true
+
+	usage := provider.Usage{}
+	if s.usage != nil {
+		usage = *s.usage
+	} else {
+		usage.PromptTokens = tokens.CountMessages(s.req.Messages)
+		usage.CompletionTokens = tokens.CountMessage(provider.Message{
+			Role:      provider.RoleAssistant,
+			Content:   s.content.String(),
+			ToolCalls: s.toolCalls,
+		})
+	}
+	s.provider.record(s.ctx, model(s.model, s.req.Model), usage)
+}
@@ -0,0 +1,254 @@
+// Package usage records the tokens used by requests and works out what they cost
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+)
+
+// ErrLimitExceeded is returned instead of making a request once the usage limit has been exceeded
+var ErrLimitExceeded = errors.New("the usage limit has been exceeded")
+
+// price is the cost of a model in USD per 1,000 tokens
+type price struct {
+	prefix     string
+	prompt     float64
+	completion float64
+}
+
+// prices is ordered so more specific model names are matched first
+var prices = []price{
+	{"gpt-4o-mini", 0.00015, 0.0006},
+	{"gpt-4o", 0.005, 0.015},
+	{"gpt-4-turbo", 0.01, 0.03},
+	{"gpt-4-1106", 0.01, 0.03},
+	{"gpt-4-0125", 0.01, 0.03},
+	{"gpt-4-32k", 0.06, 0.12},
+	{"gpt-4", 0.03, 0.06},
+	{"gpt-3.5-turbo-16k", 0.003, 0.004},
+	{"gpt-3.5-turbo", 0.0005, 0.0015},
+	{"text-embedding-3-small", 0.00002, 0},
+	{"text-embedding-3-large", 0.00013, 0},
+	{"text-embedding-ada-002", 0.0001, 0},
+}
+
+// Cost returns the cost in USD of a request to model, and false if the price of model isn't known
+func Cost(model string, usage provider.Usage) (float64, bool) {
+	model = strings.ToLower(model)
+	for _, p := range prices {
+		if strings.HasPrefix(model, p.prefix) {
+			return float64(usage.PromptTokens)/1000*p.prompt + float64(usage.CompletionTokens)/1000*p.completion, true
+		}
+	}
+	return 0, false
+}
+
+// Totals adds up the usage of several requests
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Cost             float64 `json:"cost"`
+	// UnknownCost is true if the cost of any of the requests isn't known
+	UnknownCost bool `json:"unknown_cost,omitempty"`
+}
+
+func (t Totals) add(model string, usage provider.Usage) Totals {
+	t.Requests++
+	t.PromptTokens += usage.PromptTokens
+	t.CompletionTokens += usage.CompletionTokens
+	cost, ok := Cost(model, usage)
+	t.Cost += cost
+	if !ok {
+		t.UnknownCost = true
+	}
+	return t
+}
+
+func (t Totals) String() string {
+	cost := fmt.Sprintf("$%.4f", t.Cost)
+	if t.UnknownCost {
+		cost += " (some models have no price)"
+	}
+	return fmt.Sprintf("%d requests, %d prompt tokens, %d completion tokens, %s", t.Requests, t.PromptTokens, t.CompletionTokens, cost)
+}
+
+// Tracker records usage by source and by model, it's safe for concurrent use
+type Tracker struct {
+	mu       sync.Mutex
+	Total    Totals            `json:"total"`
+	BySource map[string]Totals `json:"by_source,omitempty"`
+	ByModel  map[string]Totals `json:"by_model"`
+
+	// path is where the tracker is saved, if it's persistent
+	path string
+
+	warnLimit float64
+	limit     float64
+	warned    bool
+}
+
+// NewTracker returns a tracker which warns once the cost exceeds warnLimit,
+// and blocks requests once it exceeds limit. Either limit can be 0 to disable it.
+func NewTracker(warnLimit, limit float64) *Tracker {
+	return &Tracker{
+		BySource:  make(map[string]Totals),
+		ByModel:   make(map[string]Totals),
+		warnLimit: warnLimit,
+		limit:     limit,
+	}
+}
+
+// LoadTracker returns a tracker which is saved to path every time usage is recorded,
+// for keeping track of usage across sessions
+func LoadTracker(path string) (*Tracker, error) {
+	t := NewTracker(0, 0)
+	t.path = path
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, fmt.Errorf("error loading usage: %s", err)
+	}
+	if t.ByModel == nil {
+		t.ByModel = make(map[string]Totals)
+	}
+	// lifetime usage isn't broken down by source
+	t.BySource = nil
+
+	return t, nil
+}
+
+// Record adds the usage of a request. It returns true if the cost
+// has just exceeded the warning limit.
+func (t *Tracker) Record(source, model string, usage provider.Usage) (warn bool, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Total = t.Total.add(model, usage)
+	t.ByModel[model] = t.ByModel[model].add(model, usage)
+	if t.BySource != nil {
+		t.BySource[source] = t.BySource[source].add(model, usage)
+	}
+
+	if t.warnLimit > 0 && !t.warned && t.Total.Cost > t.warnLimit {
+		t.warned = true
+		warn = true
+	}
+
+	if t.path != "" {
+		b, err := json.Marshal(t)
+		if err != nil {
+			return warn, err
+		}
+		if err := ioutil.WriteFile(t.path, b, 0600); err != nil {
+			return warn, fmt.Errorf("error saving usage: %s", err)
+		}
+	}
+
+	return warn, nil
+}
+
+// Check returns ErrLimitExceeded if the cost has exceeded the limit
+func (t *Tracker) Check() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.limit > 0 && t.Total.Cost >= t.limit {
+		return fmt.Errorf("%w, it's $%.4f and the limit is $%.2f", ErrLimitExceeded, t.Total.Cost, t.limit)
+	}
+	return nil
+}
+
+// WarnLimit returns the cost in USD after which a warning is shown
+func (t *Tracker) WarnLimit() float64 {
+	return t.warnLimit
+}
+
+// Summary describes the usage, broken down by source and model
+func (t *Tracker) Summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := t.Total.String()
+	result += breakdown("By source", t.BySource)
+	result += breakdown("By model", t.ByModel)
+	if t.limit > 0 {
+		result += fmt.Sprintf("\n\nRequests are blocked once the cost reaches $%.2f", t.limit)
+	}
+	return result
+}
+
+func breakdown(title string, totals map[string]Totals) string {
+	if len(totals) == 0 {
+		return ""
+	}
+
+	var keys []string
+	for key := range totals {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := fmt.Sprintf("\n\n%s:\n", title)
+	for _, key := range keys {
+		result += fmt.Sprintf("\n    %s: %s", key, totals[key])
+	}
+	return result
+}
+
+type trackerKey struct{}
+type sourceKey struct{}
+type warnKey struct{}
+
+// WithTracker returns a context which records usage in tracker
+func WithTracker(ctx context.Context, tracker *Tracker) context.Context {
+	return context.WithValue(ctx, trackerKey{}, tracker)
+}
+
+// WithSource returns a context which records usage against source, for
+// example the module which made the request
+func WithSource(ctx context.Context, source string) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// WithWarnings returns a context which sends warnings, for example when the
+// warning limit is reached, to warn rather than printing them
+func WithWarnings(ctx context.Context, warn func(message string)) context.Context {
+	return context.WithValue(ctx, warnKey{}, warn)
+}
+
+func warning(ctx context.Context, message string) {
+	if w, ok := ctx.Value(warnKey{}).(func(string)); ok {
+		w(message)
+		return
+	}
+	ui.Warn(message)
+}
+
+func trackerFromContext(ctx context.Context) *Tracker {
+	tracker, _ := ctx.Value(trackerKey{}).(*Tracker)
+	return tracker
+}
+
+func sourceFromContext(ctx context.Context) string {
+	if source, ok := ctx.Value(sourceKey{}).(string); ok {
+		return source
+	}
+	return "chat"
+}
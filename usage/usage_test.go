@@ -0,0 +1,74 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/ian-kent/gptchat/provider"
+	"github.com/ian-kent/gptchat/ui"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCost(t *testing.T) {
+	cost, ok := Cost("gpt-4-0613", provider.Usage{PromptTokens: 1000, CompletionTokens: 500})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.06, cost, 0.000001)
+
+	cost, ok = Cost("gpt-4o-mini-2024-07-18", provider.Usage{PromptTokens: 1000})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.00015, cost, 0.000001)
+
+	_, ok = Cost("llama-3", provider.Usage{PromptTokens: 1000})
+	assert.False(t, ok)
+}
+
+func TestProvider(t *testing.T) {
+	ui.SetOutput(io.Discard)
+
+	path := filepath.Join(t.TempDir(), "usage.json")
+	lifetime, err := LoadTracker(path)
+	require.NoError(t, err)
+
+	fake := provider.NewFake("Hello", "Streamed response", "Too much")
+	p := NewProvider(fake, lifetime)
+
+	session := NewTracker(0, 0.001)
+	ctx := WithTracker(context.Background(), session)
+	req := provider.ChatRequest{
+		Model:    "gpt-4",
+		Messages: []provider.Message{{Role: provider.RoleUser, Content: "Hi"}},
+	}
+
+	_, err = p.CreateChatCompletion(ctx, req)
+	require.NoError(t, err)
+
+	stream, err := p.CreateChatCompletionStream(WithSource(ctx, "/memory"), req)
+	require.NoError(t, err)
+	for {
+		if _, err := stream.Recv(); errors.Is(err, io.EOF) {
+			break
+		}
+	}
+	require.NoError(t, stream.Close())
+
+	assert.Equal(t, 2, session.Total.Requests)
+	assert.Greater(t, session.Total.PromptTokens, 0)
+	assert.Greater(t, session.Total.CompletionTokens, 0)
+	assert.Equal(t, 1, session.BySource["chat"].Requests)
+	assert.Equal(t, 1, session.BySource["/memory"].Requests)
+	assert.Equal(t, 2, session.ByModel["gpt-4"].Requests)
+
+	// the session has now cost more than its limit
+	_, err = p.CreateChatCompletion(ctx, req)
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	assert.Len(t, fake.Requests(), 2)
+
+	// lifetime usage is saved
+	lifetime, err = LoadTracker(path)
+	require.NoError(t, err)
+	assert.Equal(t, session.Total, lifetime.Total)
+}
@@ -0,0 +1,9 @@
+package util
+
+import "regexp"
+
+// DateFormat is the format used for dates and times which are given to GPT
+const DateFormat = "02 January 2006, 03:04pm"
+
+// DatePattern matches dates and times formatted using DateFormat
+var DatePattern = regexp.MustCompile(`\d{2} [A-Z][a-z]+ \d{4}, \d{2}:\d{2}[ap]m`)